@@ -0,0 +1,491 @@
+package automod
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"kings-bot/db"
+)
+
+// codeBlockLimit keeps message text in a code block under Discord's 1024 character
+// embed field limit, including the fences
+const codeBlockLimit = 1000
+
+// punishment is the action automod takes against a message and its author
+type punishment struct {
+	action     string
+	duration   time.Duration                  // timeout length or temp ban length
+	deleteDays int                            // days of messages removed by a ban
+	reason     string                         // offending content shown in embeds and stored as the case content
+	normalized string                         // normalized content the rule matched, empty for built-in checks
+	auditLog   string                         // reason shown in the Discord audit log and stored as the case reason
+	source     string                         // infraction source
+	ruleID     string                         // matched rule, empty for built-in checks
+	title      string                         // title of the reply in the channel
+	shadow     bool                           // only report what would have been done
+	fields     []*discordgo.MessageEmbedField // check specific details for the log and shadow report
+	related    map[string][]string            // channel ID to earlier offending message IDs, bulk deleted too
+}
+
+// Function to apply the punishment to the message author
+func applyAction(s *discordgo.Session, m *discordgo.MessageCreate, p punishment) {
+	// Repeat offenders get the next step of the escalation ladder
+	p = loadedSettings().escalate(m, p)
+
+	// Shadow mode, report to the review channel and leave the message and user alone
+	if p.shadow {
+		sendShadowReport(s, m, p)
+		return
+	}
+
+	// Log only, the message stays and the user is not punished
+	if p.action == ActionLog {
+		flagCase := recordInfraction(s, m, db.InfractionFlag, p, 0)
+		sendActionLogMessage(s, m, p, flagCase)
+		return
+	}
+
+	// Reply and Response spam chat with reason why
+	sendActionConfirmation(s, m, p)
+
+	// Delete spam chat and the earlier offending messages from every channel
+	deleteOffendingMessages(s, m, p)
+
+	var err error
+	userName := m.Author.Username
+	switch p.action {
+	case ActionDelete:
+		deleteCase := recordInfraction(s, m, db.InfractionDelete, p, 0)
+		sendActionLogMessage(s, m, p, deleteCase)
+
+	case ActionWarn:
+		sendDirectMessage(s, m, p)
+		warnCase := recordInfraction(s, m, db.InfractionWarn, p, 0)
+		sendActionLogMessage(s, m, p, warnCase)
+
+	case ActionTimeout:
+		until := time.Now().Add(p.duration)
+		err = s.GuildMemberTimeout(m.GuildID, m.Author.ID, &until, discordgo.WithAuditLogReason(p.auditLog))
+		if err != nil {
+			fmt.Printf("Error when timing out user %s: %v\n", userName, err)
+			return
+		}
+		fmt.Printf("User %s has been timed out for %s\n", userName, p.duration)
+
+		sendDirectMessage(s, m, p)
+		timeoutCase := recordInfraction(s, m, db.InfractionTimeout, p, p.duration)
+		sendActionLogMessage(s, m, p, timeoutCase)
+
+	case ActionTempBan, ActionBan:
+		banDuration := p.duration
+		if p.action == ActionBan {
+			banDuration = 0
+		}
+
+		// Send Direct Message to Banned User while the bot still shares a server with them
+		sendDirectMessage(s, m, p)
+
+		// Banned spam user from server
+		err = s.GuildBanCreateWithReason(m.GuildID, m.Author.ID, p.auditLog, p.deleteDays)
+		if err != nil {
+			fmt.Printf("Error when banning user %s: %v\n\n", userName, err)
+			return
+		}
+		fmt.Printf("User %s has beed banned for spamming\n", userName)
+
+		// Add ban to database, temporary bans are lifted by the ticker
+		_, err = store.AddTempBan(m.Author.ID, m.GuildID, s.State.User.ID, banDuration, p.auditLog)
+		if err != nil {
+			log.Printf("Error adding temporary ban to database: %v", err)
+		}
+
+		// Record ban in moderation history
+		banCase := recordInfraction(s, m, db.InfractionBan, p, banDuration)
+
+		// Send ban log message to specific channel
+		sendActionLogMessage(s, m, p, banCase)
+	}
+}
+
+// Function to delete the message and the related offending messages, in bulk per channel,
+// so they also disappear from clients that cached them before a ban removes them
+func deleteOffendingMessages(s *discordgo.Session, m *discordgo.MessageCreate, p punishment) {
+	offending := map[string][]string{m.ChannelID: {m.ID}}
+	for channelID, messageIDs := range p.related {
+		offending[channelID] = append(offending[channelID], messageIDs...)
+	}
+
+	for channelID, messageIDs := range offending {
+		slices.Sort(messageIDs)
+		messageIDs = slices.Compact(messageIDs)
+
+		// Bulk delete takes at most 100 messages per request
+		for batch := range slices.Chunk(messageIDs, 100) {
+			err := s.ChannelMessagesBulkDelete(channelID, batch, discordgo.WithAuditLogReason(p.auditLog))
+			if err != nil {
+				fmt.Printf("Error when trying to delete %d messages in channel %s: %v\n", len(batch), channelID, err)
+			}
+		}
+	}
+}
+
+// Number of related offending messages deleted along with the message
+func relatedCount(p punishment) int {
+	count := 0
+	for _, messageIDs := range p.related {
+		count += len(messageIDs)
+	}
+	return count
+}
+
+// Title of the log message for each action
+func actionLogTitle(action string) string {
+	switch action {
+	case ActionLog:
+		return "Spam Rule Matched"
+	case ActionDelete:
+		return "Spam Message Deleted"
+	case ActionWarn:
+		return "User Warned"
+	case ActionTimeout:
+		return "User Timed Out"
+	default:
+		return "User Banned"
+	}
+}
+
+// Human readable action for embeds
+func actionDescription(p punishment) string {
+	switch p.action {
+	case ActionLog:
+		return "Logged only"
+	case ActionDelete:
+		return "Message deleted"
+	case ActionWarn:
+		return "Message deleted and user warned"
+	case ActionTimeout:
+		return fmt.Sprintf("Timeout for %s", p.duration)
+	case ActionTempBan:
+		return fmt.Sprintf("Ban for %s", p.duration)
+	default:
+		return "Permanent ban"
+	}
+}
+
+// Function to reply to the spam message with the action taken
+func sendActionConfirmation(s *discordgo.Session, m *discordgo.MessageCreate, p punishment) {
+	// Embed message for simplicity and better view
+	embed := &discordgo.MessageEmbed{
+		Title: p.title,
+		Color: 0xff0000,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "User",
+				Value:  fmt.Sprintf("%s (Username: %s)", m.Author.Mention(), m.Author.Username),
+				Inline: true,
+			},
+			{
+				Name:   "Action",
+				Value:  actionDescription(p),
+				Inline: true,
+			},
+			{
+				Name:   "Reason",
+				Value:  codeBlock(p.reason),
+				Inline: false,
+			},
+		},
+	}
+
+	msgSend := &discordgo.MessageSend{
+		Embed: embed,
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Roles: []string{},
+			Users: []string{},
+			Parse: []discordgo.AllowedMentionType{},
+		},
+		Reference: m.Reference(),
+	}
+
+	_, err := s.ChannelMessageSendComplex(m.ChannelID, msgSend)
+	if err != nil {
+		fmt.Println("Failed to send delete message", err)
+	}
+}
+
+// Function to record automod action in the infractions history, the returned case number is 0 when it could not be stored.
+// The offending message is kept apart from the reason, so /case reason does not overwrite it.
+func recordInfraction(s *discordgo.Session, m *discordgo.MessageCreate, infractionType string, p punishment, duration time.Duration) db.Infraction {
+	infraction := db.Infraction{
+		Type:        infractionType,
+		GuildID:     m.GuildID,
+		UserID:      m.Author.ID,
+		ModeratorID: s.State.User.ID,
+		Reason:      p.auditLog,
+		Content:     p.reason,
+		Source:      p.source,
+	}
+	if duration > 0 {
+		infraction.ExpiresAt = time.Now().Add(duration)
+	}
+
+	infraction, err := store.AddInfraction(infraction)
+	if err != nil {
+		log.Printf("Error adding %s infraction for user %s: %v", infractionType, m.Author.ID, err)
+		infraction.CaseNumber = 0
+	}
+	return infraction
+}
+
+// Function to send Direct Message to the punished user
+func sendDirectMessage(s *discordgo.Session, m *discordgo.MessageCreate, p punishment) {
+	endUnixTime := time.Now().Add(p.duration).Unix()
+
+	// Create Embed Message for Direct Message
+	var dmEmbed *discordgo.MessageEmbed
+	switch p.action {
+	case ActionWarn:
+		dmEmbed = &discordgo.MessageEmbed{
+			Title:       "You have received a warning in the KinG Server",
+			Description: "Your message was removed for Spamming. Repeated spam will lead to a timeout or ban.",
+		}
+	case ActionTimeout:
+		dmEmbed = &discordgo.MessageEmbed{
+			Title: "You have been timed out in the KinG Server",
+			Description: fmt.Sprintf("You have been timed out until <t:%d:F> <t:%d:R> due to Spamming and Compromissed Account. \n \n"+
+				"Please secure your account, you can chat again after the timeout ends.", endUnixTime, endUnixTime),
+		}
+	case ActionBan:
+		dmEmbed = &discordgo.MessageEmbed{
+			Title:       "You have been **Permanently** banned from the KinG Server",
+			Description: "You have been permanently banned due to Spamming and Compromissed Account.",
+		}
+	default:
+		dmEmbed = &discordgo.MessageEmbed{
+			Title: "You have been banned from the KinG Server",
+			Description: fmt.Sprintf("You have been banned until <t:%d:F> <t:%d:R> due to Spamming and Compromissed Account. \n \n"+
+				"If you have gained access and secured your account, you can rejoin after the ban period using this one time invite link:", endUnixTime, endUnixTime),
+		}
+	}
+	dmEmbed.Color = 0xff0000
+	dmEmbed.Fields = []*discordgo.MessageEmbedField{
+		{
+			Name:  "Reason",
+			Value: codeBlock(p.reason),
+		},
+	}
+
+	// Send DM to punished user
+	dmChannel, err := s.UserChannelCreate(m.Author.ID)
+	if err != nil {
+		log.Printf("Failed to send DM to punished user: %v", err)
+		return
+	} else if dmChannel == nil {
+		log.Printf("dmChannel is nil unexpectedly")
+		return
+	}
+
+	// Send DM Embed Message
+	_, err = s.ChannelMessageSendEmbed(dmChannel.ID, dmEmbed)
+	if err != nil {
+		fmt.Printf("Failed to send DM: %v", err)
+		return
+	}
+
+	// Only temporary bans need an invite to come back
+	if p.action != ActionTempBan {
+		return
+	}
+
+	// Create a single-use, never-expiring discord invite link
+	invite, err := s.ChannelInviteCreate(m.ChannelID, discordgo.Invite{
+		MaxAge:    0,
+		MaxUses:   1,
+		Temporary: false,
+	})
+	if err != nil {
+		fmt.Printf("Error creating invite: %v", err)
+		return
+	}
+
+	// Send DM invite link
+	inviteMessage := fmt.Sprintf("https://discord.gg/%s", invite.Code)
+	_, err = s.ChannelMessageSend(dmChannel.ID, inviteMessage)
+	if err != nil {
+		fmt.Printf("Failed to send invite link: %v", err)
+	}
+}
+
+// Function to send log message of the action to ban-log channel
+func sendActionLogMessage(s *discordgo.Session, m *discordgo.MessageCreate, p punishment, modCase db.Infraction) {
+	// Count all bans for this user, including the current one
+	banCount := 0
+	banHistory, err := store.GetBanHistory(m.Author.ID, m.GuildID)
+	if err != nil {
+		log.Printf("Error getting ban history for user %s: %v", m.Author.ID, err)
+	} else {
+		banCount = len(banHistory)
+	}
+
+	logEmbed := &discordgo.MessageEmbed{
+		Title: actionLogTitle(p.action),
+		Color: 0xff0000,
+		Thumbnail: &discordgo.MessageEmbedThumbnail{
+			URL: m.Author.AvatarURL(""),
+		},
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Username",
+				Value:  fmt.Sprintf("%s %s", m.Author.Mention(), m.Author.Username),
+				Inline: true,
+			},
+			{
+				Name:   "User ID",
+				Value:  m.Author.ID,
+				Inline: true,
+			},
+			{
+				Name:   "Total Bans",
+				Value:  fmt.Sprintf("%d", banCount),
+				Inline: true,
+			},
+			{
+				Name:   "Action",
+				Value:  actionDescription(p),
+				Inline: true,
+			},
+			{
+				Name:   "Channel",
+				Value:  fmt.Sprintf("<#%s>", m.ChannelID),
+				Inline: true,
+			},
+			{
+				Name:   "Reason",
+				Value:  p.auditLog,
+				Inline: false,
+			},
+			{
+				Name:   "Message",
+				Value:  codeBlock(p.reason),
+				Inline: false,
+			},
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+
+	if p.ruleID != "" {
+		logEmbed.Fields = append(logEmbed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Rule",
+			Value:  p.ruleID,
+			Inline: true,
+		})
+	}
+	if field := normalizedField(p); field != nil {
+		logEmbed.Fields = append(logEmbed.Fields, field)
+	}
+	logEmbed.Fields = append(logEmbed.Fields, p.fields...)
+	if related := relatedCount(p); related > 0 && p.action != ActionLog {
+		logEmbed.Fields = append(logEmbed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Messages Deleted",
+			Value:  fmt.Sprintf("%d", related+1),
+			Inline: true,
+		})
+	}
+
+	// Show case number so moderators can refer back to it with /case
+	if modCase.CaseNumber > 0 {
+		logEmbed.Title = fmt.Sprintf("%s | Case #%d", logEmbed.Title, modCase.CaseNumber)
+	}
+
+	logMessage, err := s.ChannelMessageSendEmbed(banLogChannelID, logEmbed)
+	if err != nil {
+		fmt.Printf("Failed to send log message: %v\n", err)
+		return
+	}
+
+	// Remember log message so /case reason can edit it
+	if modCase.CaseNumber > 0 {
+		err = store.SetCaseLogMessage(m.GuildID, modCase.CaseNumber, logMessage.ChannelID, logMessage.ID)
+		if err != nil {
+			log.Printf("Error saving log message for case %d: %v", modCase.CaseNumber, err)
+		}
+	}
+}
+
+// Function to post what automod would have done to the review channel
+func sendShadowReport(s *discordgo.Session, m *discordgo.MessageCreate, p punishment) {
+	log.Printf("Shadow mode: would apply %s to user %s", p.action, m.Author.ID)
+
+	rule := p.ruleID
+	if rule == "" {
+		rule = p.source
+	}
+
+	reportEmbed := &discordgo.MessageEmbed{
+		Title: "Automod Shadow Mode",
+		URL:   fmt.Sprintf("https://discord.com/channels/%s/%s/%s", m.GuildID, m.ChannelID, m.ID),
+		Color: 0xffa500,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Username",
+				Value:  fmt.Sprintf("%s %s", m.Author.Mention(), m.Author.Username),
+				Inline: true,
+			},
+			{
+				Name:   "Channel",
+				Value:  fmt.Sprintf("<#%s>", m.ChannelID),
+				Inline: true,
+			},
+			{
+				Name:   "Rule",
+				Value:  rule,
+				Inline: true,
+			},
+			{
+				Name:   "Would Have",
+				Value:  actionDescription(p),
+				Inline: true,
+			},
+			{
+				Name:   "Message",
+				Value:  codeBlock(p.reason),
+				Inline: false,
+			},
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+
+	if field := normalizedField(p); field != nil {
+		reportEmbed.Fields = append(reportEmbed.Fields, field)
+	}
+	reportEmbed.Fields = append(reportEmbed.Fields, p.fields...)
+
+	_, err := s.ChannelMessageSendEmbed(loadedSettings().reviewChannelID(), reportEmbed)
+	if err != nil {
+		fmt.Printf("Failed to send shadow report: %v\n", err)
+	}
+}
+
+// Embed field with the normalized text, nil when normalizing did not change the text
+func normalizedField(p punishment) *discordgo.MessageEmbedField {
+	if p.normalized == "" || p.normalized == p.reason {
+		return nil
+	}
+	return &discordgo.MessageEmbedField{
+		Name:   "Normalized",
+		Value:  codeBlock(p.normalized),
+		Inline: false,
+	}
+}
+
+// Message text as a code block for an embed field, long text is cut off
+func codeBlock(text string) string {
+	if runes := []rune(text); len(runes) > codeBlockLimit {
+		text = string(runes[:codeBlockLimit]) + "..."
+	}
+	return fmt.Sprintf("```%s```", text)
+}
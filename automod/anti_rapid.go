@@ -2,9 +2,9 @@ package automod
 
 import (
 	"fmt"
-	"log"
-	"sync"
+	"slices"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 
@@ -13,139 +13,170 @@ import (
 
 // RapidMessageData struct to store history messages per-user.
 type RapidMessageData struct {
-	MessageContent string
-	// ChannelID      string
-	Timestamp time.Time
+	MessageID         string
+	MessageContent    string
+	NormalizedContent string
+	Images            []ImageData
+	ChannelID         string
+	Timestamp         time.Time
 }
 
-// UserMessageRecord struct to store history messages for all user.
-type UserMessageRecord struct {
-	messages     map[string][]RapidMessageData
-	messageMutex sync.Mutex
+// ImageData struct to identify an image by its metadata, the image is only downloaded
+// when it is compared to an image with the same key.
+type ImageData struct {
+	Key  string
+	URL  string
+	Size int // 0 for embed images, their size is unknown until downloaded
 }
 
-var userMessages = UserMessageRecord{
-	messages: make(map[string][]RapidMessageData),
-}
-
-// CheckRapidMessages function to check for rapid message spamming more than 3 times.
+// CheckRapidMessages function to check for rapid message spamming, by default 3 copies
+// of a message within a minute, the same message posted in several channels, or more
+// messages than the flood limit allows. Near-identical text and the same image count as
+// the same message.
 func CheckRapidMessages(s *discordgo.Session, m *discordgo.MessageCreate) {
 	if m.Author.Bot || m.GuildID == "" {
 		return
 	}
 
+	// Skip staff, exempt roles, users and channels
+	loaded := loadedSettings()
+	if loaded.isExempt(s, m) {
+		return
+	}
+
 	// Get userID and message content.
 	userID := m.Author.ID
 	content := m.Content
-	guildID := m.GuildID
-	banDuration := 5 * time.Minute
-	banEndTIme := time.Now().Add(banDuration)
-	banUnixTime := banEndTIme.Unix()
-	reason := content
-
-	// Lock the mutex to ensure thread safety during message addition.
-	userMessages.messageMutex.Lock()
-	defer userMessages.messageMutex.Unlock()
-
-	// Initialize the map for the specific user if it doesn't exist.
-	if _, exists := userMessages.messages[userID]; !exists {
-		userMessages.messages[userID] = []RapidMessageData{}
+	rapid := loaded.config.Rapid
+	limits := rapid.limits(m.GuildID, m.ChannelID)
+	message := RapidMessageData{
+		MessageID:         m.ID,
+		MessageContent:    content,
+		NormalizedContent: normalizeContent(content),
+		Images:            messageImages(m.Message),
+		ChannelID:         m.ChannelID,
+		Timestamp:         time.Now(),
 	}
 
-	// Add new message to the map for the specific user.
-	userMessages.messages[userID] = append(userMessages.messages[userID], RapidMessageData{
-		MessageContent: content,
-		Timestamp:      time.Now(),
-	})
-
-	// Clean up old messages older than 1 minute in the map for a specific user.
-	cleanOldMessages(userID)
-
-	// Count identical message in 1 minute
-	count := countIdenticalMessage(userID, content)
+	// Comparing messages is slow, so it runs on a copy of the history without the
+	// user's shard locked
+	history := userMessages.add(userID, message, rapid.retention())
+	p, triggered := detectRapid(m, history, message, loaded, limits)
+	if !triggered {
+		return
+	}
 
-	// Check if identical message have been sent 3 times or more
-	if count >= 3 {
-		err := s.GuildBanCreateWithReason(m.GuildID, userID, reason, 7)
-		if err != nil {
-			log.Printf("Failed to ban user %s: %v", userID, err)
-			return
-		}
+	// Remove the punished messages from the user history. When one of them is already
+	// gone another message of the user was punished for it in the meantime.
+	acted := actedMessages(history, m.ID, p.related)
+	if removed := userMessages.remove(userID, acted); len(removed) < len(acted) {
+		return
+	}
+	applyAction(s, m, p)
+}
 
-		// Send ban confirmation message
-		sendBanConfirmation(s, m, reason)
+// detectRapid Function to check the user's history for copies of the message, copies in
+// several channels and flooding, returning the punishment when one of them triggers
+func detectRapid(m *discordgo.MessageCreate, history []RapidMessageData, message RapidMessageData, loaded *settings, limits RapidLimits) (punishment, bool) {
+	rapid := loaded.config.Rapid
+	p := punishment{
+		action:     limits.Action,
+		duration:   limits.Duration,
+		deleteDays: defaultDeleteDays,
+		reason:     message.MessageContent,
+		source:     db.SourceAutomodRapid,
+		title:      "Spam Rapid Message Detected",
+		shadow:     loaded.shadow(limits.Shadow),
+	}
 
-		// Send direct message to the banned user
-		sendDirectMessage(s, m, reason, banUnixTime)
+	// Copies of the message within the window, in any channel
+	matches := duplicateMessages(history, message, limits.Window, rapid.Similarity)
+	if len(matches) < limits.Count {
+		matches = nil
+	} else {
+		p.auditLog = fmt.Sprintf("Same message posted %d times within %s", len(matches), limits.Window)
+	}
 
-		// Add temporary ban to the database
-		err = db.AddTempBan(userID, guildID, s.State.User.ID, banDuration, reason)
-		if err != nil {
-			log.Printf("Error adding temporary ban to database: %v", err)
+	// Same message in several channels, short greetings like "gm" are left alone
+	if matches == nil && rapid.CrossChannel.Enabled && crossChannelCandidate(m, message, rapid.CrossChannel.MinLength) {
+		matches = duplicateMessages(history, message, rapid.CrossChannel.Window, rapid.Similarity)
+		channels := distinctChannels(matches)
+		if channels < rapid.CrossChannel.Channels {
+			matches = nil
+		} else {
+			p.title = "Cross-Channel Spam Detected"
+			p.auditLog = fmt.Sprintf("Same message posted in %d channels", channels)
 		}
+	}
 
-		// Send ban log message
-		sendBanLogMessage(s, m, reason)
+	// Too many messages of any content
+	if matches == nil && rapid.Flood.Enabled {
+		matches = messagesAfter(history, time.Now().Add(-rapid.Flood.Window))
+		if len(matches) <= rapid.Flood.MaxMessages {
+			return punishment{}, false
+		}
+		p.action = rapid.Flood.Action
+		p.duration = rapid.Flood.Duration
+		p.auditLog = fmt.Sprintf("%d messages in %s", len(matches), rapid.Flood.Window)
+		p.source = db.SourceAutomodFlood
+		p.title = "Message Flood Detected"
+		p.shadow = loaded.shadow(rapid.Flood.Shadow)
+	}
 
-		// Remove user history message after ban
-		delete(userMessages.messages, userID)
+	if matches == nil {
+		return punishment{}, false
 	}
+	p.related = relatedMessages(m, matches)
+	return p, true
 }
 
-// Clean up old messages older than 1 minute in the map for a specific user.
-func cleanOldMessages(userID string) {
-	cutoffContent := time.Now().Add(-1 * time.Minute)
-	var updateMessages []RapidMessageData
-
-	for _, msg := range userMessages.messages[userID] {
-		if msg.Timestamp.After(cutoffContent) {
-			updateMessages = append(updateMessages, msg)
+// Messages within window that duplicate message, including message itself
+func duplicateMessages(history []RapidMessageData, message RapidMessageData, window time.Duration, threshold float64) []RapidMessageData {
+	cutoff := time.Now().Add(-window)
+	var matches []RapidMessageData
+	for _, msg := range history {
+		if msg.Timestamp.After(cutoff) && isDuplicate(msg, message, threshold) {
+			matches = append(matches, msg)
 		}
 	}
-
-	// Update the map with the updated slice of messages.
-	userMessages.messages[userID] = updateMessages
+	return matches
 }
 
-// Count identical message in 1 minute
-func countIdenticalMessage(userID, content string) int {
-	count := 0
-	for _, msg := range userMessages.messages[userID] {
-		if msg.MessageContent == content {
-			count++
-		}
+// Whether the message is long enough or has a link or image to count as cross-channel spam
+func crossChannelCandidate(m *discordgo.MessageCreate, message RapidMessageData, minLength int) bool {
+	if utf8.RuneCountInString(message.NormalizedContent) >= minLength || len(message.Images) > 0 {
+		return true
 	}
-	return count
+	return urlPattern.MatchString(m.Content)
 }
 
-func sendBanConfirmation(s *discordgo.Session, m *discordgo.MessageCreate, reason string) {
-	embedConfirmation := &discordgo.MessageEmbed{
-		Title: "Spam Rapid Message Detected",
-		Color: 0xff0000,
-		Fields: []*discordgo.MessageEmbedField{
-			{
-				Name:   "Banned User",
-				Value:  fmt.Sprintf("%s (Username: %s)", m.Author.Mention(), m.Author.Username),
-				Inline: true,
-			},
-			{
-				Name:   "Reason",
-				Value:  fmt.Sprintf("```%s```", reason),
-				Inline: false,
-			},
-		},
+// Messages of the history the punishment acts on, the triggering message and the related ones
+func actedMessages(history []RapidMessageData, messageID string, related map[string][]string) []RapidMessageData {
+	var acted []RapidMessageData
+	for _, msg := range history {
+		if msg.MessageID == messageID || slices.Contains(related[msg.ChannelID], msg.MessageID) {
+			acted = append(acted, msg)
+		}
 	}
+	return acted
+}
 
-	msgEmbedSend := &discordgo.MessageSend{
-		Embed: embedConfirmation,
-		AllowedMentions: &discordgo.MessageAllowedMentions{
-			Parse: []discordgo.AllowedMentionType{},
-		},
-		Reference: m.Reference(),
+// Number of different channels the messages were posted in
+func distinctChannels(messages []RapidMessageData) int {
+	channels := make(map[string]bool)
+	for _, msg := range messages {
+		channels[msg.ChannelID] = true
 	}
+	return len(channels)
+}
 
-	_, err := s.ChannelMessageSendComplex(m.ChannelID, msgEmbedSend)
-	if err != nil {
-		log.Print("Failed to send ban confirmation message", err)
+// Channel ID to message IDs of the matched messages other than the triggering one
+func relatedMessages(m *discordgo.MessageCreate, messages []RapidMessageData) map[string][]string {
+	related := make(map[string][]string)
+	for _, msg := range messages {
+		if msg.MessageID != m.ID {
+			related[msg.ChannelID] = append(related[msg.ChannelID], msg.MessageID)
+		}
 	}
+	return related
 }
@@ -1,10 +1,9 @@
 package automod
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"regexp"
-	"time"
 
 	"github.com/bwmarrin/discordgo"
 
@@ -13,36 +12,42 @@ import (
 
 var (
 	banLogChannelID string
-
-	// Regex pattern for reducing false positive
-	spamRegexPattern = []string{
-		// reminder [\W\s]*: Matches zero or more non-word characters or spaces.
-		`(?i)\b(?:free|get|claim|steam|gifts?|giftaways?|gift away)\b.*?[\s\+\-@\$]*?(?:steam|gifts?|keys?|cards?|giftaways?|gift away)\b`,
-		`(?i)\b(?:free|best|onlyfans|teen|NSFW|hub|sex|leaks?|hot|nudes?|hentai)\b,*?[\W*?](?:porn|best|NSFW|hub|hot|onlyfans|teen|sex|leaks?|pussys?|nudes?|hentai)\b`,
-		`(?i)\b(?:stake|airdrop|claim|rewards?)\b.*?[\s\+\-@\$]*?(?:stake|airdrop|claim|rewards?)\b`,
-		`(?i)\b(?:nitro|free|giveaways?|give aways?)\b.*?[\s\+\-@\$]*?(?:nitro|free|giveaways?|give aways?)\b`,
-		`(?i)\b(?:crypto|casino|fasts?)\b.*?[\s\+\-@\$]*?(?:giveaways?|payouts?|luck|catch)\b`,
-		`(?i)\b(?:from|steam|free|gifts?)\b\s*[\W\s]*(?:-?\s*\d+\s*\$?|\$?\s*-?\s*\d+)|\b(?:-?\s*\d+\s*\$?|\$?\s*-?\s*\d+)\s*[\W\s]*\b(?:from|steam|free|gifts?)\b`,
-	}
-	// Slice to store regex pattern
-	compiledRegex []*regexp.Regexp
+	store           db.Store
 )
 
-// Init Precompile regex pattern during initialization
-func Init(logChannelId string) {
+// Init sets the ban log channel and storage and loads the spam rules from configFile,
+// invalid rules are reported and skipped
+func Init(logChannelId string, banStore db.Store, configFile string) {
 	banLogChannelID = logChannelId
+	store = banStore
+	configPath = configFile
 
-	compiledRegex = make([]*regexp.Regexp, len(spamRegexPattern))
-	for i, pattern := range spamRegexPattern {
-		compiled, err := regexp.Compile(pattern)
+	loaded, err := ReloadConfig()
+	if errors.Is(err, ErrConfigNotLoaded) {
+		log.Printf("Failed to load automod config, no spam rules are in use: %v", err)
+	} else {
 		if err != nil {
-			log.Fatalf("Failed to compile regex pattern: %s, error: %v", pattern, err)
+			log.Printf("Automod config problems: %v", err)
 		}
-		compiledRegex[i] = compiled
+		log.Printf("Loaded %d automod spam rules", loaded)
 	}
+
+	// Forget message histories of users who stopped posting
+	go userMessages.runJanitor()
 }
 
-// DeleteSpamMessage Function to delete spam message from the channel
+// messageCheck inspects a message and returns the punishment for it when it breaks a rule
+type messageCheck func(s *discordgo.Session, m *discordgo.MessageCreate, loaded *settings) (punishment, bool)
+
+// messageChecks run in order on every message, only the first one that triggers is applied
+var messageChecks = []messageCheck{
+	checkPhishing,
+	checkInvites,
+	checkMentions,
+	checkSpamRules,
+}
+
+// DeleteSpamMessage Function to apply the action of the first automod check matching the message
 func DeleteSpamMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 	if m.Author.ID == s.State.User.ID {
 		return
@@ -50,177 +55,66 @@ func DeleteSpamMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 
 	fmt.Println("Message Recieved:", m.Content)
 
-	// Loop regex pattern
-	for _, regex := range compiledRegex {
-		if regex.MatchString(m.Content) {
-			log.Printf("Spam detected in message from %s", m.Author.Username)
-
-			// Find the specific spam message
-			// matchedWord := regex.FindString(m.Content)
-			matchedWord := m.Content
-
-			// Reply and Response spam chat with reason why
-			responseSpam := matchedWord
-
-			// Embed message for simplicity and better view
-			embed := &discordgo.MessageEmbed{
-				Title: "Spam Message Detected",
-				Color: 0xff0000,
-				Fields: []*discordgo.MessageEmbedField{
-					{
-						Name:   "Banned User",
-						Value:  fmt.Sprintf("%s (Username: %s)", m.Author.Mention(), m.Author.Username),
-						Inline: true,
-					},
-					{
-						Name:   "Reason",
-						Value:  fmt.Sprintf("```%s```", responseSpam),
-						Inline: false,
-					},
-				},
-			}
-
-			msgSend := &discordgo.MessageSend{
-				Embed: embed,
-				AllowedMentions: &discordgo.MessageAllowedMentions{
-					Roles: []string{},
-					Users: []string{},
-					Parse: []discordgo.AllowedMentionType{},
-				},
-				Reference: m.Reference(),
-			}
-
-			_, err := s.ChannelMessageSendComplex(m.ChannelID, msgSend)
-			if err != nil {
-				fmt.Println("Failed to send delete message", err)
-			}
-
-			// Delete spam chat from channel
-			err = s.ChannelMessageDelete(m.ChannelID, m.ID)
-			if err != nil {
-				fmt.Println("Error when trying to delete message", err)
-			}
-
-			// Banned spam chats members
-			guildID := m.GuildID
-			// userID := m.Author.ID
-			userName := m.Author.Username
-
-			if guildID == "" {
-				fmt.Println("Guild ID cant be found, can't ban member")
-				return
-			}
-
-			// Calculate the ban end time based on Unix timestamp
-			banDuration := 2 * time.Minute
-			banEndTime := time.Now().Add(banDuration)
-			banUnixTime := banEndTime.Unix()
-
-			// Send Direct Message to Banned User
-			sendDirectMessage(s, m, responseSpam, banUnixTime)
-
-			// Banned spam user from server
-			reasonBan := "Spamming detected"
-			err = s.GuildBanCreateWithReason(m.GuildID, m.Author.ID, reasonBan, 7)
-			if err != nil {
-				fmt.Printf("Error when banning user %s: %v\n\n", userName, err)
-			} else {
-				fmt.Printf("User %s has beed banned for spamming\n", userName)
-
-				// Add temporary ban to database
-				err = db.AddTempBan(m.Author.ID, m.GuildID, s.State.User.ID, banDuration, reasonBan)
-				if err != nil {
-					log.Printf("Error adding temporary ban to database: %v", err)
-				}
-
-				// Send ban log message to specific channel
-				sendBanLogMessage(s, m, responseSpam)
-			}
-			return
-		}
-	}
-}
-
-// Function to send Direct Message to Banned User
-func sendDirectMessage(s *discordgo.Session, m *discordgo.MessageCreate, responseSpam string, banUnixTime int64) {
-	// Create a single-use, never-expiring discord invite link
-	invite, err := s.ChannelInviteCreate(m.ChannelID, discordgo.Invite{
-		MaxAge:    0,
-		MaxUses:   1,
-		Temporary: false,
-	})
-	if err != nil {
-		fmt.Printf("Error creating invite: %v", err)
+	if m.GuildID == "" {
+		return
 	}
 
-	// Create Embed Message for Direct Message
-	dmEmbed := &discordgo.MessageEmbed{
-		Title: "You have been banned from the KinG Server",
-		Description: fmt.Sprintf("You have been banned until <t:%d:F> <t:%d:R> due to Spamming and Compromissed Account. \n \n"+
-			"If you have gained access and secured your account, you can rejoin after the ban period using this one time invite link:", banUnixTime, banUnixTime),
-		Color: 0xff0000,
-		Fields: []*discordgo.MessageEmbedField{
-			{
-				Name:  "Reason",
-				Value: fmt.Sprintf("```%s```", responseSpam),
-			},
-		},
+	// Skip staff, exempt roles, users and channels
+	loaded := loadedSettings()
+	if loaded.isExempt(s, m) {
+		return
 	}
 
-	// Send DM to banned user
-	dmChannel, err := s.UserChannelCreate(m.Author.ID)
-	if err != nil {
-		log.Printf("Failed to send DM to banned user: %v", err)
-	} else if dmChannel == nil {
-		log.Printf("dmChannel is nil unexpectedly")
-	} else {
-		// Send DM Embed Message
-		_, err = s.ChannelMessageSendEmbed(dmChannel.ID, dmEmbed)
-		if err != nil {
-			fmt.Printf("Failed to send DM: %v", err)
-			return
-		}
-
-		// Send DM invite link
-		inviteMessage := fmt.Sprintf("https://discord.gg/%s", invite.Code)
-		_, err = s.ChannelMessageSend(dmChannel.ID, inviteMessage)
-		if err != nil {
-			fmt.Printf("Failed to send invite link: %v", err)
+	for _, check := range messageChecks {
+		if p, ok := check(s, m, loaded); ok {
+			// Earlier copies of the spam are deleted along with it
+			if !p.shadow && p.action != ActionLog {
+				p.related = offendingCopies(m, loaded)
+			}
+			applyAction(s, m, p)
 			return
 		}
 	}
 }
 
-// Function to send log banned message to ban-log channel
-func sendBanLogMessage(s *discordgo.Session, m *discordgo.MessageCreate, responseSpam string) {
-	logEmbed := &discordgo.MessageEmbed{
-		Title: "User Banned",
-		Color: 0xff0000,
-		Thumbnail: &discordgo.MessageEmbedThumbnail{
-			URL: m.Author.AvatarURL(""),
-		},
-		Fields: []*discordgo.MessageEmbedField{
-			{
-				Name:   "Username",
-				Value:  fmt.Sprintf("%s %s", m.Author.Mention(), m.Author.Username),
-				Inline: true,
-			},
-			{
-				Name:   "User ID",
-				Value:  m.Author.ID,
-				Inline: true,
-			},
-			{
-				Name:   "Reason",
-				Value:  fmt.Sprintf("```%s```", responseSpam),
-				Inline: false,
-			},
-		},
-		Timestamp: time.Now().Format(time.RFC3339),
+// offendingCopies Function to take the user's recent copies of the message out of the
+// rapid message history, as channel ID to message IDs
+func offendingCopies(m *discordgo.MessageCreate, loaded *settings) map[string][]string {
+	message := RapidMessageData{
+		MessageID:         m.ID,
+		MessageContent:    m.Content,
+		NormalizedContent: normalizeContent(m.Content),
+		ChannelID:         m.ChannelID,
 	}
+	copies := userMessages.takeDuplicates(m.Author.ID, message, loaded.config.Rapid.Similarity)
+	return relatedMessages(m, copies)
+}
 
-	_, err := s.ChannelMessageSendEmbed(banLogChannelID, logEmbed)
-	if err != nil {
-		fmt.Printf("Failed to send log message: %v\n", err)
+// checkSpamRules Function to match the message against the spam rules, the first matching rule is applied
+func checkSpamRules(s *discordgo.Session, m *discordgo.MessageCreate, loaded *settings) (punishment, bool) {
+	// Rules are matched against the original text and its normalized form,
+	// so look-alike letters, zero-width characters and leetspeak do not evade them
+	normalized := normalizeContent(m.Content)
+
+	// Loop spam rules
+	for _, rule := range loaded.rules {
+		if rule.regex.MatchString(m.Content) || rule.regex.MatchString(normalized) {
+			log.Printf("Spam detected in message from %s by rule %s, original: %q, normalized: %q",
+				m.Author.Username, rule.ID, m.Content, normalized)
+
+			return punishment{
+				action:     rule.Action,
+				duration:   rule.Duration,
+				deleteDays: rule.deleteDays,
+				reason:     m.Content,
+				normalized: normalized,
+				auditLog:   fmt.Sprintf("Spamming detected (rule %s)", rule.ID),
+				source:     db.SourceAutomodSpam,
+				ruleID:     rule.ID,
+				title:      "Spam Message Detected",
+				shadow:     loaded.shadow(rule.Shadow),
+			}, true
+		}
 	}
+	return punishment{}, false
 }
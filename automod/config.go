@@ -0,0 +1,486 @@
+package automod
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule severities
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// Rule actions
+const (
+	ActionLog     = "log"     // only post to the ban log channel
+	ActionDelete  = "delete"  // delete the message
+	ActionWarn    = "warn"    // delete the message and warn the user
+	ActionTimeout = "timeout" // delete the message and time the user out for duration
+	ActionTempBan = "tempban" // ban the user for duration
+	ActionBan     = "ban"     // ban the user permanently
+)
+
+const (
+	// defaultTempBanDuration is used by tempban rules without a duration
+	defaultTempBanDuration = 2 * time.Minute
+	// defaultDeleteDays is used by ban rules without delete_days
+	defaultDeleteDays = 7
+	// maxTimeoutDuration is the longest timeout Discord allows
+	maxTimeoutDuration = 28 * 24 * time.Hour
+)
+
+// defaultConfig is used when the config file does not exist
+//
+//go:embed default_config.yaml
+var defaultConfig []byte
+
+// Config is the automod configuration file
+type Config struct {
+	// ShadowMode makes every check only report what it would have done
+	ShadowMode bool `yaml:"shadow_mode"`
+	// ReviewChannelID receives shadow mode reports, defaults to the ban log channel
+	ReviewChannelID string       `yaml:"review_channel_id"`
+	Rules           []Rule       `yaml:"rules"`
+	Rapid           RapidConfig  `yaml:"rapid"`
+	Exempt          ExemptConfig `yaml:"exempt"`
+	// Escalation replaces the action of punishing checks for repeat offenders
+	Escalation EscalationConfig `yaml:"escalation"`
+	Phishing   PhishingConfig   `yaml:"phishing"`
+	Invites    InviteConfig     `yaml:"invites"`
+	Mentions   MentionConfig    `yaml:"mentions"`
+}
+
+// CheckAction is the action of a built-in check
+type CheckAction struct {
+	// Action has the same values as rule actions
+	Action string `yaml:"action"`
+	// Duration of the timeout or temp ban
+	Duration time.Duration `yaml:"duration"`
+	// Shadow only reports what the check would have done
+	Shadow bool `yaml:"shadow"`
+}
+
+// RapidConfig configures the rapid identical message check
+type RapidConfig struct {
+	// Limits used in channels without their own
+	RapidLimits `yaml:",inline"`
+	// Similarity from which two messages count as the same, 1 only matches identical text
+	Similarity float64 `yaml:"similarity"`
+	// CrossChannel catches the same message posted once in each of several channels
+	CrossChannel CrossChannelConfig `yaml:"cross_channel"`
+	// Guilds overrides the limits per guild ID
+	Guilds map[string]RapidLimits `yaml:"guilds"`
+	// Channels overrides the limits per channel ID, taking precedence over the guild
+	Channels map[string]RapidLimits `yaml:"channels"`
+	// Flood limits the number of messages of any content
+	Flood FloodConfig `yaml:"flood"`
+}
+
+// RapidLimits are the rapid message settings that can differ per guild and channel,
+// zero values in an override keep the value it overrides
+type RapidLimits struct {
+	// Count of copies of a message within Window that is punished
+	Count int `yaml:"count"`
+	// Window is how far back copies are counted
+	Window time.Duration `yaml:"window"`
+	// Action applied to rapid message spam, same values as rule actions, defaults to a timeout
+	CheckAction `yaml:",inline"`
+}
+
+// CrossChannelConfig configures the cross-channel duplicate check of the rapid message check
+type CrossChannelConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Channels is the number of different channels that is punished
+	Channels int `yaml:"channels"`
+	// Window is how far back messages are compared
+	Window time.Duration `yaml:"window"`
+	// MinLength is the shortest normalized text that is compared, shorter messages only
+	// count when they have a link or an image
+	MinLength int `yaml:"min_length"`
+}
+
+// FloodConfig configures the message rate limit, whether or not the messages are the same
+type FloodConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxMessages is the most messages allowed within Window
+	MaxMessages int `yaml:"max_messages"`
+	// Window the messages are counted in
+	Window time.Duration `yaml:"window"`
+	// Action for members over the limit
+	CheckAction `yaml:",inline"`
+}
+
+const (
+	// defaultRapidCount is the number of copies punished when no count is configured
+	defaultRapidCount = 3
+	// defaultRapidWindow is how far back copies are counted when no window is configured
+	defaultRapidWindow = time.Minute
+	// defaultRapidAction is applied to rapid message spam when no action is configured
+	defaultRapidAction = ActionTimeout
+	// defaultRapidDuration is the length of the default rapid message timeout
+	defaultRapidDuration = 5 * time.Minute
+	// defaultCrossChannels is the default number of channels for cross-channel spam
+	defaultCrossChannels = 3
+	// defaultCrossChannelWindow is the default window of the cross-channel check
+	defaultCrossChannelWindow = 10 * time.Minute
+	// defaultCrossChannelMinLength is the default shortest text of the cross-channel check
+	defaultCrossChannelMinLength = 20
+	// defaultFloodMessages is the default number of messages allowed by the flood limit
+	defaultFloodMessages = 8
+	// defaultFloodWindow is the default window of the flood limit
+	defaultFloodWindow = 5 * time.Second
+)
+
+// validateRapid fills in the defaults of the rapid message check and checks its actions.
+// An invalid action falls back to the default, invalid overrides are dropped and an
+// invalid flood limit is disabled.
+func validateRapid(rapid *RapidConfig) error {
+	if rapid.Similarity <= 0 || rapid.Similarity > 1 {
+		rapid.Similarity = defaultSimilarity
+	}
+	if rapid.CrossChannel.Channels < 2 {
+		rapid.CrossChannel.Channels = defaultCrossChannels
+	}
+	if rapid.CrossChannel.Window <= 0 {
+		rapid.CrossChannel.Window = defaultCrossChannelWindow
+	}
+	if rapid.CrossChannel.MinLength <= 0 {
+		rapid.CrossChannel.MinLength = defaultCrossChannelMinLength
+	}
+	if rapid.Count < 2 {
+		rapid.Count = defaultRapidCount
+	}
+	if rapid.Window <= 0 {
+		rapid.Window = defaultRapidWindow
+	}
+
+	if rapid.Action == "" {
+		rapid.Action = defaultRapidAction
+		if rapid.Duration == 0 {
+			rapid.Duration = defaultRapidDuration
+		}
+	}
+
+	var errs []error
+	if err := validateAction(rapid.Action, &rapid.Duration); err != nil {
+		rapid.Action = defaultRapidAction
+		rapid.Duration = defaultRapidDuration
+		errs = append(errs, fmt.Errorf("rapid: %w, using %s for %s", err, defaultRapidAction, defaultRapidDuration))
+	}
+
+	for guildID, override := range rapid.Guilds {
+		if err := rapid.validateOverride(&override); err != nil {
+			errs = append(errs, fmt.Errorf("rapid guild %s: %w, override ignored", guildID, err))
+			delete(rapid.Guilds, guildID)
+			continue
+		}
+		rapid.Guilds[guildID] = override
+	}
+	for channelID, override := range rapid.Channels {
+		if err := rapid.validateOverride(&override); err != nil {
+			errs = append(errs, fmt.Errorf("rapid channel %s: %w, override ignored", channelID, err))
+			delete(rapid.Channels, channelID)
+			continue
+		}
+		rapid.Channels[channelID] = override
+	}
+
+	if err := validateFlood(&rapid.Flood); err != nil {
+		errs = append(errs, fmt.Errorf("rapid flood: %w, flood limit disabled", err))
+		rapid.Flood.Enabled = false
+	}
+	return errors.Join(errs...)
+}
+
+// validateOverride checks a guild or channel override and fills in the duration of its action
+func (rapid *RapidConfig) validateOverride(override *RapidLimits) error {
+	if override.Count == 1 || override.Count < 0 {
+		return fmt.Errorf("count must be at least 2")
+	}
+	if override.Window < 0 {
+		return fmt.Errorf("window must be positive")
+	}
+	if override.Action == "" && override.Duration == 0 {
+		return nil
+	}
+
+	merged := rapid.RapidLimits.merge(*override)
+	if err := validateAction(merged.Action, &merged.Duration); err != nil {
+		return err
+	}
+	if override.Action != "" {
+		override.Action = merged.Action
+	}
+	override.Duration = merged.Duration
+	return nil
+}
+
+// validateFlood fills in the defaults of the flood limit and checks its action
+func validateFlood(flood *FloodConfig) error {
+	if !flood.Enabled {
+		return nil
+	}
+	if flood.MaxMessages <= 0 {
+		flood.MaxMessages = defaultFloodMessages
+	}
+	if flood.Window <= 0 {
+		flood.Window = defaultFloodWindow
+	}
+	if flood.Action == "" {
+		flood.Action = defaultRapidAction
+		if flood.Duration == 0 {
+			flood.Duration = defaultRapidDuration
+		}
+	}
+	return validateAction(flood.Action, &flood.Duration)
+}
+
+// limits returns the rapid message limits of a channel, channel overrides take precedence
+// over guild overrides
+func (rapid *RapidConfig) limits(guildID, channelID string) RapidLimits {
+	return rapid.RapidLimits.merge(rapid.Guilds[guildID]).merge(rapid.Channels[channelID])
+}
+
+// retention is how long messages must be kept to cover every window
+func (rapid *RapidConfig) retention() time.Duration {
+	retention := max(rapid.Window, rapid.CrossChannel.Window, rapid.Flood.Window)
+	for _, override := range rapid.Guilds {
+		retention = max(retention, override.Window)
+	}
+	for _, override := range rapid.Channels {
+		retention = max(retention, override.Window)
+	}
+	return retention
+}
+
+// merge returns the limits with the values set in override replacing them
+func (limits RapidLimits) merge(override RapidLimits) RapidLimits {
+	if override.Count > 0 {
+		limits.Count = override.Count
+	}
+	if override.Window > 0 {
+		limits.Window = override.Window
+	}
+	if override.Action != "" {
+		limits.Action = override.Action
+		limits.Duration = override.Duration
+	} else if override.Duration > 0 {
+		limits.Duration = override.Duration
+	}
+	limits.Shadow = limits.Shadow || override.Shadow
+	return limits
+}
+
+// Rule is a single spam rule matched against message content
+type Rule struct {
+	ID          string `yaml:"id"`
+	Pattern     string `yaml:"pattern"`
+	Description string `yaml:"description"`
+	Severity    string `yaml:"severity"`
+	Action      string `yaml:"action"`
+	// Duration of a timeout or temp ban, e.g. 10m or 24h
+	Duration time.Duration `yaml:"duration"`
+	// DeleteDays of messages removed by a ban (0-7), defaults to 7
+	DeleteDays *int `yaml:"delete_days"`
+	// Shadow only reports matches of this rule without acting on them
+	Shadow bool `yaml:"shadow"`
+}
+
+// compiledRule is a valid rule with its precompiled regex
+type compiledRule struct {
+	Rule
+	regex      *regexp.Regexp
+	deleteDays int
+}
+
+// settings is the loaded configuration, replaced as a whole on reload
+type settings struct {
+	config Config
+	rules  []compiledRule
+	// blocklist holds the registrable domains of the phishing blocklist
+	blocklist map[string]bool
+}
+
+var (
+	configPath string
+
+	// current holds the settings used by the message handlers
+	current atomic.Pointer[settings]
+	// settingsMutex serializes changes of the current settings and the blocklist file,
+	// readers only load current
+	settingsMutex sync.Mutex
+)
+
+// ErrConfigNotLoaded is wrapped by ReloadConfig when the config file cannot be read or
+// parsed, nothing is applied and the previous settings stay in use
+var ErrConfigNotLoaded = errors.New("automod config not loaded")
+
+// loadedSettings returns the settings in use, empty before the first load
+func loadedSettings() *settings {
+	if loaded := current.Load(); loaded != nil {
+		return loaded
+	}
+	return &settings{}
+}
+
+// shadow reports whether a check with its own shadow flag only reports instead of acting
+func (st *settings) shadow(checkShadow bool) bool {
+	return st.config.ShadowMode || checkShadow
+}
+
+// reviewChannelID is the channel receiving shadow mode reports
+func (st *settings) reviewChannelID() string {
+	if st.config.ReviewChannelID != "" {
+		return st.config.ReviewChannelID
+	}
+	return banLogChannelID
+}
+
+// ReloadConfig reads the config file again and swaps in its rules.
+// Invalid rules are skipped and reported in the returned error, the valid ones are still applied.
+// When the file cannot be read or parsed the previous settings stay in use and the error
+// wraps ErrConfigNotLoaded.
+func ReloadConfig() (int, error) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	data, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("Automod config %s not found, using built-in defaults", configPath)
+		data = defaultConfig
+	} else if err != nil {
+		return 0, fmt.Errorf("%w: error reading automod config: %w", ErrConfigNotLoaded, err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return 0, fmt.Errorf("%w: error parsing automod config %s: %w", ErrConfigNotLoaded, configPath, err)
+	}
+
+	rules, ruleErrs := compileRules(config.Rules)
+	if err := validateRapid(&config.Rapid); err != nil {
+		ruleErrs = append(ruleErrs, err)
+	}
+	if err := validateEscalation(&config.Escalation); err != nil {
+		ruleErrs = append(ruleErrs, fmt.Errorf("%w, escalation disabled", err))
+		config.Escalation.Enabled = false
+	}
+	if err := validatePhishing(&config.Phishing); err != nil {
+		ruleErrs = append(ruleErrs, fmt.Errorf("%w, phishing check disabled", err))
+		config.Phishing.Enabled = false
+	}
+	if err := validateInvites(&config.Invites); err != nil {
+		ruleErrs = append(ruleErrs, fmt.Errorf("%w, invite check disabled", err))
+		config.Invites.Enabled = false
+	}
+	if err := validateMentions(&config.Mentions); err != nil {
+		ruleErrs = append(ruleErrs, fmt.Errorf("%w, mention check disabled", err))
+		config.Mentions.Enabled = false
+	}
+	blocklist, err := loadBlocklist(config.Phishing.BlocklistFile)
+	if err != nil {
+		ruleErrs = append(ruleErrs, err)
+	}
+	current.Store(&settings{
+		config:    config,
+		rules:     rules,
+		blocklist: blocklist,
+	})
+
+	return len(rules), errors.Join(ruleErrs...)
+}
+
+// compileRules validates the rules and compiles their patterns, invalid rules are left out
+func compileRules(rules []Rule) ([]compiledRule, []error) {
+	var (
+		compiled []compiledRule
+		errs     []error
+		seen     = make(map[string]bool)
+	)
+
+	for i, rule := range rules {
+		if rule.ID == "" {
+			errs = append(errs, fmt.Errorf("rule %d: missing id", i+1))
+			continue
+		}
+		if seen[rule.ID] {
+			errs = append(errs, fmt.Errorf("rule %s: duplicate id", rule.ID))
+			continue
+		}
+		seen[rule.ID] = true
+
+		if rule.Severity == "" {
+			rule.Severity = SeverityMedium
+		}
+		switch rule.Severity {
+		case SeverityLow, SeverityMedium, SeverityHigh:
+		default:
+			errs = append(errs, fmt.Errorf("rule %s: unknown severity %q", rule.ID, rule.Severity))
+			continue
+		}
+
+		if rule.Action == "" {
+			rule.Action = ActionTempBan
+		}
+		if err := validateAction(rule.Action, &rule.Duration); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", rule.ID, err))
+			continue
+		}
+
+		deleteDays := defaultDeleteDays
+		if rule.DeleteDays != nil {
+			deleteDays = *rule.DeleteDays
+		}
+		if deleteDays < 0 || deleteDays > 7 {
+			errs = append(errs, fmt.Errorf("rule %s: delete_days must be between 0 and 7", rule.ID))
+			continue
+		}
+
+		if rule.Pattern == "" {
+			errs = append(errs, fmt.Errorf("rule %s: missing pattern", rule.ID))
+			continue
+		}
+		regex, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: invalid pattern: %w", rule.ID, err))
+			continue
+		}
+
+		compiled = append(compiled, compiledRule{Rule: rule, regex: regex, deleteDays: deleteDays})
+	}
+	return compiled, errs
+}
+
+// validateAction checks the action and its duration, filling in the default temp ban duration
+func validateAction(action string, duration *time.Duration) error {
+	switch action {
+	case ActionLog, ActionDelete, ActionWarn, ActionBan:
+		return nil
+	case ActionTimeout:
+		if *duration <= 0 || *duration > maxTimeoutDuration {
+			return fmt.Errorf("timeout duration must be between 1s and %s", maxTimeoutDuration)
+		}
+		return nil
+	case ActionTempBan:
+		if *duration == 0 {
+			*duration = defaultTempBanDuration
+		}
+		if *duration < 0 {
+			return fmt.Errorf("tempban duration must be positive")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+}
@@ -0,0 +1,122 @@
+package automod
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"kings-bot/db"
+)
+
+// automodSourcePrefix is shared by the infraction sources of every automod check
+const automodSourcePrefix = "automod-"
+
+// EscalationConfig is the ladder of actions for repeat automod offenders
+type EscalationConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Window is how far back prior automod infractions are counted
+	Window time.Duration `yaml:"window"`
+	// Steps are applied in order, the first for a first offense,
+	// the last one for every offense past the end of the ladder
+	Steps []EscalationStep `yaml:"steps"`
+}
+
+// EscalationStep is the action for one rung of the ladder
+type EscalationStep struct {
+	Action   string        `yaml:"action"`
+	Duration time.Duration `yaml:"duration"`
+}
+
+// validateEscalation checks the ladder steps, only punishing actions can be steps
+func validateEscalation(escalation *EscalationConfig) error {
+	if !escalation.Enabled {
+		return nil
+	}
+	if escalation.Window <= 0 {
+		return fmt.Errorf("escalation: window must be positive")
+	}
+	if len(escalation.Steps) == 0 {
+		return fmt.Errorf("escalation: no steps")
+	}
+
+	for i := range escalation.Steps {
+		step := &escalation.Steps[i]
+		switch step.Action {
+		case ActionWarn, ActionTimeout, ActionTempBan, ActionBan:
+		default:
+			return fmt.Errorf("escalation step %d: action must be warn, timeout, tempban or ban", i+1)
+		}
+		if err := validateAction(step.Action, &step.Duration); err != nil {
+			return fmt.Errorf("escalation step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// escalate replaces the punishment with the ladder step for the user's number of prior
+// automod warns, timeouts and bans in the window when the step is harsher than the
+// check's own action. Log and delete actions are never escalated.
+func (st *settings) escalate(m *discordgo.MessageCreate, p punishment) punishment {
+	escalation := st.config.Escalation
+	if !escalation.Enabled {
+		return p
+	}
+	switch p.action {
+	case ActionLog, ActionDelete:
+		return p
+	}
+
+	infractions, err := store.ListInfractions(m.Author.ID, m.GuildID)
+	if err != nil {
+		log.Printf("Error getting infractions for escalation of user %s: %v", m.Author.ID, err)
+		return p
+	}
+
+	since := time.Now().Add(-escalation.Window)
+	offenses := 0
+	for _, inf := range infractions {
+		// Deleted and logged messages are not offenses that escalate
+		switch inf.Type {
+		case db.InfractionUnban, db.InfractionDelete, db.InfractionFlag:
+			continue
+		}
+		if !strings.HasPrefix(inf.Source, automodSourcePrefix) {
+			continue
+		}
+		if inf.CreatedAt.After(since) {
+			offenses++
+		}
+	}
+
+	// The ladder only makes punishments harsher, a rule set to ban stays a ban
+	step := escalation.Steps[min(offenses, len(escalation.Steps)-1)]
+	if !harsher(step.Action, step.Duration, p.action, p.duration) {
+		return p
+	}
+	p.action = step.Action
+	p.duration = step.Duration
+	log.Printf("Escalating user %s to %s after %d prior automod infractions", m.Author.ID, step.Action, offenses)
+	return p
+}
+
+// actionSeverity orders the actions from mildest to harshest
+var actionSeverity = map[string]int{
+	ActionLog:     0,
+	ActionDelete:  1,
+	ActionWarn:    2,
+	ActionTimeout: 3,
+	ActionTempBan: 4,
+	ActionBan:     5,
+}
+
+// harsher reports whether action a is harsher than action b,
+// the longer duration is harsher for the same action
+func harsher(a string, aDuration time.Duration, b string, bDuration time.Duration) bool {
+	if actionSeverity[a] != actionSeverity[b] {
+		return actionSeverity[a] > actionSeverity[b]
+	}
+	return aDuration > bDuration
+}
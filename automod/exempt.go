@@ -0,0 +1,57 @@
+package automod
+
+import (
+	"log"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ExemptConfig lists who and where automod does not act.
+// Members with the Ban Members permission are always exempt.
+type ExemptConfig struct {
+	Roles    []string `yaml:"roles"`
+	Users    []string `yaml:"users"`
+	Channels []string `yaml:"channels"`
+}
+
+// isExempt reports whether automod must leave the message alone
+func (st *settings) isExempt(s *discordgo.Session, m *discordgo.MessageCreate) bool {
+	exempt := st.config.Exempt
+
+	if slices.Contains(exempt.Users, m.Author.ID) {
+		return true
+	}
+
+	// Messages in threads are exempt when their parent channel is
+	if slices.Contains(exempt.Channels, m.ChannelID) {
+		return true
+	}
+	if channel, err := s.State.Channel(m.ChannelID); err == nil && channel.IsThread() && slices.Contains(exempt.Channels, channel.ParentID) {
+		return true
+	}
+
+	if m.Member != nil {
+		for _, roleID := range m.Member.Roles {
+			if slices.Contains(exempt.Roles, roleID) {
+				return true
+			}
+		}
+	}
+
+	return hasPermission(s, m, discordgo.PermissionBanMembers)
+}
+
+// hasPermission reports whether the message author has the permission in the message channel
+func hasPermission(s *discordgo.Session, m *discordgo.MessageCreate, permission int64) bool {
+	// Webhook messages have no member to compute permissions for
+	if m.Member == nil {
+		return false
+	}
+	permissions, err := s.State.MessagePermissions(m.Message)
+	if err != nil {
+		log.Printf("Failed to get permissions of user %s: %v", m.Author.ID, err)
+		return false
+	}
+	return permissions&permission != 0
+}
@@ -0,0 +1,176 @@
+package automod
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"kings-bot/db"
+)
+
+// InviteConfig configures the Discord invite link check
+type InviteConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AllowedGuilds are the server IDs invites may point to, this server is always allowed
+	AllowedGuilds []string `yaml:"allowed_guilds"`
+	// ExemptRoles may post invites to any server
+	ExemptRoles []string `yaml:"exempt_roles"`
+	// CacheTTL is how long a resolved invite is remembered
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// Action for invites to servers not on the allowlist
+	CheckAction `yaml:",inline"`
+}
+
+const (
+	// defaultInviteCacheTTL is used when no cache_ttl is configured
+	defaultInviteCacheTTL = time.Hour
+	// maxCachedInvites is the cache size above which expired invites are dropped
+	maxCachedInvites = 1000
+)
+
+// invitePattern finds discord.gg/code and discord.com/invite/code links
+var invitePattern = regexp.MustCompile(`(?i)(?:discord(?:app)?\.com/invite|discord\.gg)/([a-z0-9-]+)`)
+
+// inviteTarget is the server an invite leads to
+type inviteTarget struct {
+	guildID   string // empty for unknown or expired invites
+	guildName string
+	expires   time.Time
+}
+
+// InviteCache remembers the servers of resolved invites
+type InviteCache struct {
+	targets     map[string]inviteTarget
+	targetMutex sync.Mutex
+}
+
+var inviteCache = InviteCache{
+	targets: make(map[string]inviteTarget),
+}
+
+// validateInvites fills in the defaults of the invite check and checks its action
+func validateInvites(invites *InviteConfig) error {
+	if !invites.Enabled {
+		return nil
+	}
+	if invites.Action == "" {
+		invites.Action = ActionDelete
+	}
+	if invites.CacheTTL <= 0 {
+		invites.CacheTTL = defaultInviteCacheTTL
+	}
+	if err := validateAction(invites.Action, &invites.Duration); err != nil {
+		return fmt.Errorf("invites: %w", err)
+	}
+	return nil
+}
+
+// checkInvites flags invites to servers that are not on the allowlist
+func checkInvites(s *discordgo.Session, m *discordgo.MessageCreate, loaded *settings) (punishment, bool) {
+	invites := loaded.config.Invites
+	if !invites.Enabled {
+		return punishment{}, false
+	}
+	if m.Member != nil && slices.ContainsFunc(m.Member.Roles, func(role string) bool {
+		return slices.Contains(invites.ExemptRoles, role)
+	}) {
+		return punishment{}, false
+	}
+
+	for _, code := range inviteCodes(m.Message) {
+		target, err := resolveInvite(s, code, invites.CacheTTL)
+		if err != nil {
+			// Leave the message alone rather than deleting it because the API failed
+			log.Printf("Error resolving invite %s: %v", code, err)
+			continue
+		}
+		if target.guildID == m.GuildID || slices.Contains(invites.AllowedGuilds, target.guildID) {
+			continue
+		}
+
+		server := "Unknown or expired invite"
+		if target.guildID != "" {
+			server = fmt.Sprintf("%s (%s)", target.guildName, target.guildID)
+		}
+		log.Printf("Invite %s to %s detected in message from %s", code, server, m.Author.Username)
+
+		return punishment{
+			action:     invites.Action,
+			duration:   invites.Duration,
+			deleteDays: defaultDeleteDays,
+			reason:     m.Content,
+			auditLog:   fmt.Sprintf("Invite to a server that is not allowed (%s)", server),
+			source:     db.SourceAutomodInvite,
+			title:      "Server Invite Removed",
+			shadow:     loaded.shadow(invites.Shadow),
+			fields: []*discordgo.MessageEmbedField{
+				{
+					Name:   "Invite Server",
+					Value:  server,
+					Inline: true,
+				},
+			},
+		}, true
+	}
+	return punishment{}, false
+}
+
+// inviteCodes returns the code of every invite link in the message content and its embeds
+func inviteCodes(message *discordgo.Message) []string {
+	var codes []string
+	for _, text := range messageTexts(message) {
+		for _, match := range invitePattern.FindAllStringSubmatch(text, -1) {
+			if !slices.Contains(codes, match[1]) {
+				codes = append(codes, match[1])
+			}
+		}
+	}
+	return codes
+}
+
+// resolveInvite looks up the server of an invite, from the cache when possible.
+// Unknown and expired invites resolve to an empty server and are cached too.
+func resolveInvite(s *discordgo.Session, code string, ttl time.Duration) (inviteTarget, error) {
+	inviteCache.targetMutex.Lock()
+	target, ok := inviteCache.targets[code]
+	inviteCache.targetMutex.Unlock()
+	if ok && time.Now().Before(target.expires) {
+		return target, nil
+	}
+
+	// Ask Discord without holding the lock
+	target = inviteTarget{expires: time.Now().Add(ttl)}
+	invite, err := s.Invite(code)
+	var restErr *discordgo.RESTError
+	switch {
+	case err == nil && invite.Guild != nil:
+		target.guildID = invite.Guild.ID
+		target.guildName = invite.Guild.Name
+	case err == nil:
+		// Group DM invites have no server
+	case errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound:
+		// Unknown or expired invite
+	default:
+		return inviteTarget{}, err
+	}
+
+	inviteCache.targetMutex.Lock()
+	defer inviteCache.targetMutex.Unlock()
+	if len(inviteCache.targets) >= maxCachedInvites {
+		now := time.Now()
+		for cached, cachedTarget := range inviteCache.targets {
+			if now.After(cachedTarget.expires) {
+				delete(inviteCache.targets, cached)
+			}
+		}
+	}
+	inviteCache.targets[code] = target
+	return target, nil
+}
@@ -0,0 +1,110 @@
+package automod
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"kings-bot/db"
+)
+
+// MentionConfig configures the mass mention check, a message over any limit is punished
+type MentionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxUserMentions is the most user mentions one message may have, repeats included
+	MaxUserMentions int `yaml:"max_user_mentions"`
+	// MaxRoleMentions is the most role mentions one message may have
+	MaxRoleMentions int `yaml:"max_role_mentions"`
+	// MaxEveryoneAttempts is the most @everyone and @here a member without the
+	// Mention Everyone permission may write, 0 flags every attempt
+	MaxEveryoneAttempts int `yaml:"max_everyone_attempts"`
+	// Action for messages over a limit
+	CheckAction `yaml:",inline"`
+}
+
+const (
+	defaultMaxUserMentions = 10
+	defaultMaxRoleMentions = 5
+	// defaultMentionDuration is the timeout length when no action is configured
+	defaultMentionDuration = time.Hour
+)
+
+var (
+	userMentionPattern = regexp.MustCompile(`<@!?\d+>`)
+	roleMentionPattern = regexp.MustCompile(`<@&\d+>`)
+)
+
+// validateMentions fills in the default limits and action of the mass mention check
+func validateMentions(mentions *MentionConfig) error {
+	if !mentions.Enabled {
+		return nil
+	}
+	if mentions.MaxUserMentions <= 0 {
+		mentions.MaxUserMentions = defaultMaxUserMentions
+	}
+	if mentions.MaxRoleMentions <= 0 {
+		mentions.MaxRoleMentions = defaultMaxRoleMentions
+	}
+	if mentions.MaxEveryoneAttempts < 0 {
+		return fmt.Errorf("mentions: max_everyone_attempts must not be negative")
+	}
+	if mentions.Action == "" {
+		mentions.Action = ActionTimeout
+		if mentions.Duration == 0 {
+			mentions.Duration = defaultMentionDuration
+		}
+	}
+	if err := validateAction(mentions.Action, &mentions.Duration); err != nil {
+		return fmt.Errorf("mentions: %w", err)
+	}
+	return nil
+}
+
+// checkMentions flags messages mentioning too many users or roles and @everyone attempts
+func checkMentions(s *discordgo.Session, m *discordgo.MessageCreate, loaded *settings) (punishment, bool) {
+	mentions := loaded.config.Mentions
+	if !mentions.Enabled {
+		return punishment{}, false
+	}
+
+	userMentions := len(userMentionPattern.FindAllString(m.Content, -1))
+	roleMentions := len(roleMentionPattern.FindAllString(m.Content, -1))
+
+	var violation string
+	switch {
+	case userMentions > mentions.MaxUserMentions:
+		violation = fmt.Sprintf("%d user mentions", userMentions)
+	case roleMentions > mentions.MaxRoleMentions:
+		violation = fmt.Sprintf("%d role mentions", roleMentions)
+	default:
+		attempts := strings.Count(m.Content, "@everyone") + strings.Count(m.Content, "@here")
+		// Only look up permissions when there is an attempt to check
+		if attempts <= mentions.MaxEveryoneAttempts || hasPermission(s, m, discordgo.PermissionMentionEveryone) {
+			return punishment{}, false
+		}
+		violation = fmt.Sprintf("%d @everyone or @here attempts", attempts)
+	}
+	log.Printf("Mass mention (%s) detected in message from %s", violation, m.Author.Username)
+
+	return punishment{
+		action:     mentions.Action,
+		duration:   mentions.Duration,
+		deleteDays: defaultDeleteDays,
+		reason:     m.Content,
+		auditLog:   fmt.Sprintf("Mass mention detected (%s)", violation),
+		source:     db.SourceAutomodMention,
+		title:      "Mass Mention Detected",
+		shadow:     loaded.shadow(mentions.Shadow),
+		fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Mentions",
+				Value:  violation,
+				Inline: true,
+			},
+		},
+	}, true
+}
@@ -0,0 +1,187 @@
+package automod
+
+import (
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// messageShards is the number of independently locked parts of the message store
+	messageShards = 32
+	// maxTrackedUsers is the most users with a message history, the least recently
+	// active user is dropped when a shard is full
+	maxTrackedUsers = 50_000
+	// maxUserMessages is the most messages kept per user, older ones are dropped first
+	maxUserMessages = 100
+	// janitorInterval is how often histories of inactive users are removed
+	janitorInterval = time.Minute
+)
+
+// UserMessageRecord struct to store history messages for the users of one shard.
+type UserMessageRecord struct {
+	messages     map[string][]RapidMessageData
+	messageMutex sync.Mutex
+}
+
+// MessageStore keeps the recent messages of every user, split into shards by user ID
+// so handlers of different users rarely wait on the same lock
+type MessageStore struct {
+	shards [messageShards]*UserMessageRecord
+}
+
+var userMessages = newMessageStore()
+
+func newMessageStore() *MessageStore {
+	store := &MessageStore{}
+	for i := range store.shards {
+		store.shards[i] = &UserMessageRecord{
+			messages: make(map[string][]RapidMessageData),
+		}
+	}
+	return store
+}
+
+// shard returns the part of the store holding the user
+func (ms *MessageStore) shard(userID string) *UserMessageRecord {
+	hash := fnv.New32a()
+	hash.Write([]byte(userID))
+	return ms.shards[hash.Sum32()%messageShards]
+}
+
+// update replaces the user's history with what fn returns, the shard stays locked while fn
+// runs, so fn must not make network calls. Returning an empty history removes the user.
+func (ms *MessageStore) update(userID string, fn func(history []RapidMessageData) []RapidMessageData) {
+	shard := ms.shard(userID)
+	shard.messageMutex.Lock()
+	defer shard.messageMutex.Unlock()
+
+	history, tracked := shard.messages[userID]
+	history = fn(history)
+	if len(history) == 0 {
+		delete(shard.messages, userID)
+		return
+	}
+	if len(history) > maxUserMessages {
+		history = slices.Clone(history[len(history)-maxUserMessages:])
+	}
+
+	if !tracked && len(shard.messages) >= maxTrackedUsers/messageShards {
+		shard.evictLeastRecent()
+	}
+	shard.messages[userID] = history
+}
+
+// add appends the message to the user's history, drops messages older than retention and
+// returns a copy of the history that can be read without the shard locked
+func (ms *MessageStore) add(userID string, message RapidMessageData, retention time.Duration) []RapidMessageData {
+	var snapshot []RapidMessageData
+	ms.update(userID, func(history []RapidMessageData) []RapidMessageData {
+		history = append(messagesAfter(history, time.Now().Add(-retention)), message)
+		snapshot = slices.Clone(history[max(len(history)-maxUserMessages, 0):])
+		return history
+	})
+	return snapshot
+}
+
+// history returns a copy of the user's history
+func (ms *MessageStore) history(userID string) []RapidMessageData {
+	shard := ms.shard(userID)
+	shard.messageMutex.Lock()
+	defer shard.messageMutex.Unlock()
+
+	return slices.Clone(shard.messages[userID])
+}
+
+// remove deletes the messages from the user's history by ID and returns those that were
+// still there
+func (ms *MessageStore) remove(userID string, messages []RapidMessageData) []RapidMessageData {
+	ids := make(map[string]bool, len(messages))
+	for _, msg := range messages {
+		ids[msg.MessageID] = true
+	}
+
+	var removed []RapidMessageData
+	ms.update(userID, func(history []RapidMessageData) []RapidMessageData {
+		var kept []RapidMessageData
+		for _, msg := range history {
+			if ids[msg.MessageID] {
+				removed = append(removed, msg)
+			} else {
+				kept = append(kept, msg)
+			}
+		}
+		return kept
+	})
+	return removed
+}
+
+// takeDuplicates removes the copies of message from the user's history and returns them,
+// the copies are found without the shard locked
+func (ms *MessageStore) takeDuplicates(userID string, message RapidMessageData, threshold float64) []RapidMessageData {
+	var copies []RapidMessageData
+	for _, msg := range ms.history(userID) {
+		if isDuplicate(msg, message, threshold) {
+			copies = append(copies, msg)
+		}
+	}
+	if len(copies) == 0 {
+		return nil
+	}
+	return ms.remove(userID, copies)
+}
+
+// evictLeastRecent removes the user whose last message is the oldest
+func (record *UserMessageRecord) evictLeastRecent() {
+	var (
+		oldestUser string
+		oldestTime time.Time
+	)
+	for userID, history := range record.messages {
+		last := history[len(history)-1].Timestamp
+		if oldestUser == "" || last.Before(oldestTime) {
+			oldestUser, oldestTime = userID, last
+		}
+	}
+	delete(record.messages, oldestUser)
+}
+
+// removeExpired drops messages older than ttl and users without newer messages
+func (ms *MessageStore) removeExpired(ttl time.Duration) {
+	cutoff := time.Now().Add(-ttl)
+	for _, shard := range ms.shards {
+		shard.messageMutex.Lock()
+		for userID, history := range shard.messages {
+			history = messagesAfter(history, cutoff)
+			if len(history) == 0 {
+				delete(shard.messages, userID)
+				continue
+			}
+			shard.messages[userID] = history
+		}
+		shard.messageMutex.Unlock()
+	}
+}
+
+// runJanitor Function to remove expired message histories in the background,
+// so users who stopped posting do not stay in memory
+func (ms *MessageStore) runJanitor() {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ms.removeExpired(loadedSettings().config.Rapid.retention())
+	}
+}
+
+// messagesAfter returns the messages sent after cutoff
+func messagesAfter(history []RapidMessageData, cutoff time.Time) []RapidMessageData {
+	var recent []RapidMessageData
+	for _, msg := range history {
+		if msg.Timestamp.After(cutoff) {
+			recent = append(recent, msg)
+		}
+	}
+	return recent
+}
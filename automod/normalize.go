@@ -0,0 +1,141 @@
+package automod
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables maps Cyrillic and Greek look-alikes to the Latin letter they imitate
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ї': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd',
+	'ԛ': 'q', 'ԝ': 'w', 'һ': 'h', 'ӏ': 'l', 'ɡ': 'g',
+	'А': 'a', 'В': 'b', 'Е': 'e', 'К': 'k', 'М': 'm', 'Н': 'h', 'О': 'o', 'Р': 'p', 'С': 'c',
+	'Т': 't', 'У': 'y', 'Х': 'x', 'І': 'i', 'Ј': 'j', 'Ѕ': 's',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'ω': 'w',
+	'Α': 'a', 'Β': 'b', 'Ε': 'e', 'Ζ': 'z', 'Η': 'h', 'Ι': 'i', 'Κ': 'k', 'Μ': 'm', 'Ν': 'n',
+	'Ο': 'o', 'Ρ': 'p', 'Τ': 't', 'Υ': 'y', 'Χ': 'x',
+}
+
+// leetspeak maps digits and symbols used in place of letters
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l',
+}
+
+// normalizeContent folds message text into the plain lower case form spam rules are also
+// matched against, so look-alike letters, invisible characters, leetspeak and
+// punctuation inserted between letters do not hide spam words.
+func normalizeContent(content string) string {
+	// NFKC folds fullwidth and styled letters, NFD splits off accents to be dropped
+	content = norm.NFD.String(norm.NFKC.String(content))
+
+	var b strings.Builder
+	for _, r := range content {
+		switch {
+		// Zero-width and other format characters, and the accents split off above
+		case unicode.Is(unicode.Cf, r), unicode.Is(unicode.Mn, r):
+			continue
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		default:
+			if folded, ok := confusables[r]; ok {
+				r = folded
+			}
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+
+	words := strings.Fields(b.String())
+	for i, word := range words {
+		words[i] = collapsePunctuation(foldLeetspeak(word))
+	}
+	return strings.Join(joinSpacedLetters(words), " ")
+}
+
+// foldLeetspeak replaces leetspeak in words that also contain letters, so "n1tro" becomes
+// "nitro" while amounts like "50" or "$100" stay. Symbols are only folded between two
+// letters or digits, keeping trailing punctuation like "free!" intact.
+func foldLeetspeak(word string) string {
+	runes := []rune(word)
+
+	hasLetter := false
+	for _, r := range runes {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+			break
+		}
+	}
+	if !hasLetter {
+		return word
+	}
+
+	folded := make([]rune, len(runes))
+	for i, r := range runes {
+		folded[i] = r
+		letter, ok := leetspeak[r]
+		if !ok {
+			continue
+		}
+		if unicode.IsDigit(r) || (i > 0 && i < len(runes)-1 && isWordRune(runes[i-1]) && isWordRune(runes[i+1])) {
+			folded[i] = letter
+		}
+	}
+	return string(folded)
+}
+
+// collapsePunctuation drops punctuation between two letters, "fr.ee" becomes "free",
+// and squeezes repeated punctuation like "!!!" into one character
+func collapsePunctuation(word string) string {
+	runes := []rune(word)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			if i > 0 && i < len(runes)-1 && unicode.IsLetter(runes[i-1]) && unicode.IsLetter(runes[i+1]) {
+				continue
+			}
+			if i > 0 && runes[i-1] == r {
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// joinSpacedLetters merges runs of three or more single letters, "f r e e" becomes "free"
+func joinSpacedLetters(words []string) []string {
+	var (
+		joined []string
+		run    []string
+	)
+	flush := func() {
+		if len(run) >= 3 {
+			joined = append(joined, strings.Join(run, ""))
+		} else {
+			joined = append(joined, run...)
+		}
+		run = run[:0]
+	}
+
+	for _, word := range words {
+		if r := []rune(word); len(r) == 1 && unicode.IsLetter(r[0]) {
+			run = append(run, word)
+			continue
+		}
+		flush()
+		joined = append(joined, word)
+	}
+	flush()
+	return joined
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
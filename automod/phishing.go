@@ -0,0 +1,344 @@
+package automod
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+	"golang.org/x/text/unicode/norm"
+
+	"kings-bot/db"
+)
+
+// PhishingConfig configures the phishing link check
+type PhishingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// BlocklistFile has one phishing domain per line, # starts a comment
+	BlocklistFile string `yaml:"blocklist_file"`
+	// Action for links to a blocklisted domain
+	CheckAction `yaml:",inline"`
+	Typosquat   TyposquatConfig `yaml:"typosquat"`
+}
+
+// TyposquatConfig configures the check for look-alikes of protected domains
+type TyposquatConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Protected are the real domains, links to them are never flagged
+	Protected []string `yaml:"protected"`
+	// Allow lists domains close to a protected one that are known to be fine
+	Allow []string `yaml:"allow"`
+	// MaxDistance is the largest edit distance between domain names still flagged
+	MaxDistance int `yaml:"max_distance"`
+	// Action for links to a look-alike domain
+	CheckAction `yaml:",inline"`
+}
+
+// urlPattern finds links with or without scheme, e.g. https://example.com/path or example.com
+var urlPattern = regexp.MustCompile(`(?i)(?:https?://)?(?:[\p{L}\p{N}-]+\.)+\p{L}{2,}(?::\d+)?(?:/[^\s<>"()]*)?`)
+
+// validatePhishing fills in defaults and checks the actions of the phishing check
+func validatePhishing(phishing *PhishingConfig) error {
+	if !phishing.Enabled {
+		return nil
+	}
+	if phishing.Action == "" {
+		phishing.Action = ActionDelete
+	}
+	if err := validateAction(phishing.Action, &phishing.Duration); err != nil {
+		return fmt.Errorf("phishing: %w", err)
+	}
+
+	typosquat := &phishing.Typosquat
+	if !typosquat.Enabled {
+		return nil
+	}
+	if typosquat.Action == "" {
+		typosquat.Action = ActionDelete
+	}
+	if err := validateAction(typosquat.Action, &typosquat.Duration); err != nil {
+		return fmt.Errorf("phishing typosquat: %w", err)
+	}
+	if typosquat.MaxDistance <= 0 {
+		typosquat.MaxDistance = 2
+	}
+	for i, domain := range typosquat.Protected {
+		typosquat.Protected[i] = registrableDomain(domain)
+	}
+	for i, domain := range typosquat.Allow {
+		typosquat.Allow[i] = registrableDomain(domain)
+	}
+	return nil
+}
+
+// loadBlocklist reads the blocklist file into a set of registrable domains
+func loadBlocklist(path string) (map[string]bool, error) {
+	blocklist := make(map[string]bool)
+	if path == "" {
+		return blocklist, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return blocklist, fmt.Errorf("error reading phishing blocklist: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if domain := registrableDomain(strings.TrimSpace(line)); domain != "" {
+			blocklist[domain] = true
+		}
+	}
+	return blocklist, scanner.Err()
+}
+
+// BlockDomain adds the domain of a link to the phishing blocklist file and starts blocking it
+// right away, returning the blocked registrable domain
+func BlockDomain(link string) (string, error) {
+	domain := registrableDomain(linkHost(strings.TrimSpace(link)))
+	if domain == "" {
+		return "", errors.New("not a valid domain")
+	}
+
+	// Hold the settings lock from reading to storing, so a reload in between is not lost
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	loaded := loadedSettings()
+	path := loaded.config.Phishing.BlocklistFile
+	if path == "" {
+		return "", errors.New("no phishing blocklist_file configured")
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := fmt.Fprintln(file, domain); err != nil {
+		_ = file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	// Swap in a copy of the settings with the extra domain
+	updated := *loaded
+	updated.blocklist = make(map[string]bool, len(loaded.blocklist)+1)
+	for blocked := range loaded.blocklist {
+		updated.blocklist[blocked] = true
+	}
+	updated.blocklist[domain] = true
+	current.Store(&updated)
+	return domain, nil
+}
+
+// checkPhishing flags links to blocklisted domains and look-alikes of protected domains
+func checkPhishing(s *discordgo.Session, m *discordgo.MessageCreate, loaded *settings) (punishment, bool) {
+	phishing := loaded.config.Phishing
+	if !phishing.Enabled {
+		return punishment{}, false
+	}
+
+	for _, host := range extractHosts(m.Message) {
+		domain := registrableDomain(host)
+		if domain == "" {
+			continue
+		}
+
+		if loaded.blocklist[domain] {
+			log.Printf("Phishing link to %s detected in message from %s", domain, m.Author.Username)
+			return phishingPunishment(m, loaded, phishing.CheckAction, "phishing-blocklist", domain,
+				fmt.Sprintf("Phishing link detected (%s)", domain)), true
+		}
+
+		if target, ok := loaded.typosquatTarget(domain); ok {
+			log.Printf("Look-alike of %s (%s) detected in message from %s", target, domain, m.Author.Username)
+			return phishingPunishment(m, loaded, phishing.Typosquat.CheckAction, "phishing-typosquat", domain,
+				fmt.Sprintf("Look-alike of %s detected (%s)", target, domain)), true
+		}
+	}
+	return punishment{}, false
+}
+
+// phishingPunishment Function to build the punishment of a phishing link
+func phishingPunishment(m *discordgo.MessageCreate, loaded *settings, action CheckAction, ruleID, domain, auditLog string) punishment {
+	return punishment{
+		action:     action.Action,
+		duration:   action.Duration,
+		deleteDays: defaultDeleteDays,
+		reason:     m.Content,
+		auditLog:   auditLog,
+		source:     db.SourceAutomodPhishing,
+		ruleID:     fmt.Sprintf("%s (%s)", ruleID, domain),
+		title:      "Phishing Link Detected",
+		shadow:     loaded.shadow(action.Shadow),
+	}
+}
+
+// typosquatTarget returns the protected domain that domain imitates, either by look-alike
+// letters or by a small edit distance between the names without public suffix.
+// The same name on another public suffix, like discord.dev, is not a look-alike, Discord
+// and Steam own many of those, phishing ones belong on the blocklist.
+func (st *settings) typosquatTarget(domain string) (string, bool) {
+	typosquat := st.config.Phishing.Typosquat
+	if !typosquat.Enabled {
+		return "", false
+	}
+	if slices.Contains(typosquat.Protected, domain) || slices.Contains(typosquat.Allow, domain) {
+		return "", false
+	}
+
+	folded := skeleton(domain)
+	// Punycode with letters folding to Latin ones, like dіscord.com with a Cyrillic "і"
+	homoglyph := folded != domain
+	name := domainName(folded)
+	for _, protected := range typosquat.Protected {
+		protectedName := domainName(protected)
+		distance := levenshtein(name, protectedName)
+		if distance == 0 && !homoglyph {
+			continue
+		}
+
+		// Short names allow fewer edits, "disco" is not a look-alike of "discord"
+		maxDistance := min(typosquat.MaxDistance, len(protectedName)/4)
+		if distance <= maxDistance {
+			return protected, true
+		}
+	}
+	return "", false
+}
+
+// extractHosts returns the host of every link in the message content and its embeds
+func extractHosts(message *discordgo.Message) []string {
+	var hosts []string
+	for _, text := range messageTexts(message) {
+		for _, link := range urlPattern.FindAllString(text, -1) {
+			if host := linkHost(link); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+// messageTexts returns the message content and the text of its embeds that may contain links,
+// without zero-width characters hidden inside a link to split it
+func messageTexts(message *discordgo.Message) []string {
+	texts := []string{message.Content}
+	for _, embed := range message.Embeds {
+		texts = append(texts, embed.URL, embed.Title, embed.Description)
+		for _, field := range embed.Fields {
+			texts = append(texts, field.Value)
+		}
+	}
+
+	for i, text := range texts {
+		texts[i] = strings.Map(func(r rune) rune {
+			if unicode.Is(unicode.Cf, r) {
+				return -1
+			}
+			return r
+		}, text)
+	}
+	return texts
+}
+
+// linkHost returns the host of a link with or without scheme
+func linkHost(link string) string {
+	if !strings.Contains(strings.ToLower(link), "://") {
+		link = "http://" + link
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// registrableDomain returns the punycode registrable domain of host, e.g. "login.xn--dscord-3ya.com"
+// becomes "xn--dscord-3ya.com", or "" when host has no known public suffix
+func registrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if host == "" {
+		return ""
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return ""
+	}
+
+	// Ignore things like file.txt that only look like a domain
+	suffix, icann := publicsuffix.PublicSuffix(ascii)
+	if !icann && !strings.Contains(suffix, ".") {
+		return ""
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(ascii)
+	if err != nil {
+		return ""
+	}
+	return domain
+}
+
+// skeleton decodes punycode and folds look-alike letters, so "xn--dscord-3ya.com" with a
+// Cyrillic "і" compares like "discord.com"
+func skeleton(domain string) string {
+	unicodeDomain, err := idna.Lookup.ToUnicode(domain)
+	if err != nil {
+		return domain
+	}
+
+	var b strings.Builder
+	for _, r := range norm.NFD.String(norm.NFKC.String(unicodeDomain)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if folded, ok := confusables[r]; ok {
+			r = folded
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// domainName strips the public suffix, "discord.com" becomes "discord"
+func domainName(domain string) string {
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return strings.TrimSuffix(strings.TrimSuffix(domain, suffix), ".")
+}
+
+// levenshtein returns the number of single character edits between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		row := make([]int, len(rb)+1)
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			row[j] = min(previous[j]+1, row[j-1]+1, previous[j-1]+cost)
+		}
+		previous = row
+	}
+	return previous[len(rb)]
+}
@@ -0,0 +1,91 @@
+package automod
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultSettings returns the settings of the built-in default config
+func defaultSettings(t *testing.T) *settings {
+	t.Helper()
+
+	var config Config
+	if err := yaml.Unmarshal(defaultConfig, &config); err != nil {
+		t.Fatalf("parsing default config: %v", err)
+	}
+	if err := validatePhishing(&config.Phishing); err != nil {
+		t.Fatalf("validating default phishing config: %v", err)
+	}
+	return &settings{config: config}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"discord.com", "discord.com"},
+		{"Discord.COM.", "discord.com"},
+		{"cdn.discordapp.com", "discordapp.com"},
+		{"login.example.co.uk", "example.co.uk"},
+		{"dіscord.com", "xn--dscord-pvf.com"},
+		{"xn--dscord-3ya.com", "xn--dscord-3ya.com"},
+		{"file.txt", ""},
+		{"localhost", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := registrableDomain(test.host); got != test.want {
+			t.Errorf("registrableDomain(%q) = %q, want %q", test.host, got, test.want)
+		}
+	}
+}
+
+func TestTyposquatTarget(t *testing.T) {
+	loaded := defaultSettings(t)
+
+	tests := []struct {
+		domain string
+		want   string // empty when the domain must not be flagged
+	}{
+		// Official domains
+		{"discord.com", ""},
+		{"discord.gg", ""},
+		{"discord.dev", ""},
+		{"discord.new", ""},
+		{"discord.media", ""},
+		{"discord.co", ""},
+		{"discord.design", ""},
+		{"discordapp.com", ""},
+		{"discordstatus.com", ""},
+		{"steamcommunity.com", ""},
+		{"steampowered.com", ""},
+		// Unrelated domains
+		{"disco.com", ""},
+		{"discover.com", ""},
+		{"google.com", ""},
+		{"steam.tv", ""},
+		// Same name on another suffix is left to the blocklist
+		{"discord.xyz", ""},
+		// Look-alikes
+		{"dlscord.com", "discord.com"},
+		{"discorrd.gift", "discord.com"},
+		{"steamcornmunity.com", "steamcommunity.com"},
+		{"steamcommunlty.ru", "steamcommunity.com"},
+		{"steampowerd.com", "steampowered.com"},
+		{"xn--dscord-pvf.com", "discord.com"},
+	}
+
+	for _, test := range tests {
+		domain := registrableDomain(test.domain)
+		got, ok := loaded.typosquatTarget(domain)
+		if test.want == "" && ok {
+			t.Errorf("typosquatTarget(%q) flagged as look-alike of %s", test.domain, got)
+		}
+		if test.want != "" && (!ok || got != test.want) {
+			t.Errorf("typosquatTarget(%q) = %q, %v, want %q", test.domain, got, ok, test.want)
+		}
+	}
+}
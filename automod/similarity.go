@@ -0,0 +1,185 @@
+package automod
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// defaultSimilarity is the similarity from which two messages count as duplicates
+	defaultSimilarity = 0.8
+	// maxCompareRunes limits the text compared, so long messages stay cheap to compare
+	maxCompareRunes = 500
+	// maxImageSize is the largest image downloaded for hashing
+	maxImageSize = 8 << 20
+	// maxCachedHashes is the most image hashes kept, the cache is emptied when full
+	maxCachedHashes = 1024
+)
+
+// imageClient downloads attachments and embed images for hashing
+var imageClient = &http.Client{Timeout: 10 * time.Second}
+
+// isDuplicate reports whether two messages are the same spam, either by similar text or by
+// sharing an image. Messages without text and images are never duplicates.
+func isDuplicate(a, b RapidMessageData, threshold float64) bool {
+	for _, image := range a.Images {
+		for _, other := range b.Images {
+			if sameImage(image, other) {
+				return true
+			}
+		}
+	}
+	if a.NormalizedContent == "" || b.NormalizedContent == "" {
+		return false
+	}
+	return similarity(a.NormalizedContent, b.NormalizedContent) >= threshold
+}
+
+// similarity returns 1 minus the edit distance relative to the longer text, from 0 for
+// completely different to 1 for identical. Only the start of long texts is compared.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	ra, rb = ra[:min(len(ra), maxCompareRunes)], rb[:min(len(rb), maxCompareRunes)]
+
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(string(ra), string(rb)))/float64(longest)
+}
+
+// messageImages returns the images attached or embedded in the message. Nothing is
+// downloaded here, images are only hashed when they are compared to a matching image.
+func messageImages(m *discordgo.Message) []ImageData {
+	var images []ImageData
+	for _, attachment := range m.Attachments {
+		if !strings.HasPrefix(attachment.ContentType, "image/") {
+			continue
+		}
+		images = append(images, ImageData{
+			Key:  fmt.Sprintf("%s:%d:%dx%d", attachment.ContentType, attachment.Size, attachment.Width, attachment.Height),
+			URL:  attachment.URL,
+			Size: attachment.Size,
+		})
+	}
+
+	for _, embed := range m.Embeds {
+		var (
+			imageURL      string
+			width, height int
+		)
+		switch {
+		case embed.Image != nil:
+			imageURL, width, height = embed.Image.ProxyURL, embed.Image.Width, embed.Image.Height
+		case embed.Thumbnail != nil:
+			imageURL, width, height = embed.Thumbnail.ProxyURL, embed.Thumbnail.Width, embed.Thumbnail.Height
+		default:
+			continue
+		}
+		if imageURL == "" {
+			continue
+		}
+		// Without dimensions only the same URL matches
+		key := "embed:" + imageURL
+		if width > 0 && height > 0 {
+			key = fmt.Sprintf("embed:%dx%d", width, height)
+		}
+		images = append(images, ImageData{Key: key, URL: imageURL})
+	}
+	return images
+}
+
+// sameImage reports whether two images have the same content. Images with different
+// metadata are never the same, so only images matching in size and dimensions are
+// downloaded. When an image cannot be hashed only attachments, whose key holds content
+// type, size and dimensions, count as the same by metadata. Embed images only have
+// dimensions, which unrelated link previews often share.
+func sameImage(a, b ImageData) bool {
+	if a.Key != b.Key {
+		return false
+	}
+	if a.URL == b.URL {
+		return true
+	}
+	hashA, errA := imageHashes.hash(a)
+	hashB, errB := imageHashes.hash(b)
+	if errA != nil || errB != nil {
+		return a.Size > 0
+	}
+	return hashA == hashB
+}
+
+// ImageHashCache keeps the content hashes of downloaded images by URL
+type ImageHashCache struct {
+	hashes map[string]string
+	mutex  sync.Mutex
+}
+
+var imageHashes = &ImageHashCache{hashes: make(map[string]string)}
+
+// hash returns the SHA-256 of the image, downloading it the first time. Images larger
+// than maxImageSize by their metadata are not downloaded.
+func (c *ImageHashCache) hash(image ImageData) (string, error) {
+	c.mutex.Lock()
+	hash, cached := c.hashes[image.URL]
+	c.mutex.Unlock()
+	if cached {
+		return hash, nil
+	}
+
+	if image.Size > maxImageSize {
+		return "", fmt.Errorf("image larger than %d bytes", maxImageSize)
+	}
+	// Download without holding the lock
+	hash, err := downloadHash(image.URL)
+	if err != nil {
+		log.Printf("Error hashing image %s: %v", image.URL, err)
+		return "", err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.hashes) >= maxCachedHashes {
+		clear(c.hashes)
+	}
+	c.hashes[image.URL] = hash
+	return hash, nil
+}
+
+// downloadHash downloads the file and returns the hex SHA-256 of its content
+func downloadHash(url string) (string, error) {
+	resp, err := imageClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength > maxImageSize {
+		return "", fmt.Errorf("image larger than %d bytes", maxImageSize)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return "", err
+	}
+	if size > maxImageSize {
+		return "", fmt.Errorf("image larger than %d bytes", maxImageSize)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
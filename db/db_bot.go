@@ -1,93 +1,243 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
+// SQLStore is the Store backed by a SQLite or PostgreSQL database
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// Open opens the store described by dsn. postgres:// and postgresql:// URLs select
+// PostgreSQL, anything else is used as a SQLite path (":memory:" included).
+func Open(dsn string) (*SQLStore, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return OpenPostgres(dsn)
+	}
+	return OpenSQLite(dsn)
+}
+
+// sqliteBusyTimeout is how long SQLite waits for a lock held by another connection
+const sqliteBusyTimeout = 5 * time.Second
+
+// OpenSQLite opens the SQLite database at path, creating its directory when missing,
+// enables WAL mode and a busy timeout, and applies pending schema migrations
+func OpenSQLite(path string) (*SQLStore, error) {
+	// Every connection to :memory: is a separate database
+	if path == ":memory:" {
+		conn, err := sql.Open("sqlite3", path)
+		if err != nil {
+			return nil, err
+		}
+		conn.SetMaxOpenConns(1)
+		return newSQLStore(conn, SQLite)
+	}
 
-func InitDB() error {
-	var err error
-	DB, err = sql.Open("sqlite3", "db/databot.sqlite")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating database directory: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d", path, sqliteBusyTimeout.Milliseconds())
+	conn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	_, err = DB.Exec(`
-		CREATE TABLE IF NOT EXISTS tempbans (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id TEXT NOT NULL,
-			guild_id TEXT NOT NULL,
-			ban_start TEXT NOT NULL,
-			ban_end TEXT,
-			reason TEXT,
-			banned_by TEXT NOT NULL
-		)
-	`)
+		return nil, err
+	}
+	return newSQLStore(conn, SQLite)
+}
+
+// OpenPostgres opens the PostgreSQL database at dsn and applies pending schema migrations
+func OpenPostgres(dsn string) (*SQLStore, error) {
+	conn, err := sql.Open("postgres", dsn)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	return newSQLStore(conn, Postgres)
+}
+
+// pingTimeout bounds the startup health check of the database
+const pingTimeout = 10 * time.Second
+
+func newSQLStore(conn *sql.DB, dialect Dialect) (*SQLStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	if err := conn.PingContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("error connecting to %s database: %w", dialect, err)
 	}
-	return nil
+
+	if err := Migrate(conn, dialect); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &SQLStore{db: conn, dialect: dialect}, nil
+}
+
+// Close closes the underlying database
+func (st *SQLStore) Close() error {
+	return st.db.Close()
 }
 
-func AddTempBan(userID, guildID, bannedBy string, duration time.Duration, reason string) error {
+func (st *SQLStore) exec(query string, args ...any) (sql.Result, error) {
+	return st.db.Exec(st.dialect.rebind(query), args...)
+}
+
+func (st *SQLStore) query(query string, args ...any) (*sql.Rows, error) {
+	return st.db.Query(st.dialect.rebind(query), args...)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// insert runs an INSERT on q and returns the generated id column,
+// PostgreSQL has no LastInsertId so the id is read with RETURNING
+func (st *SQLStore) insert(q execer, query string, args ...any) (int64, error) {
+	if st.dialect == Postgres {
+		var id int64
+		err := q.QueryRow(st.dialect.rebind(query)+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// AddTempBan records a ban in the history and returns its ID, duration 0 means a permanent ban
+func (st *SQLStore) AddTempBan(userID, guildID, bannedBy string, duration time.Duration, reason string) (int64, error) {
 	banStart := time.Now().UTC().Format(time.RFC3339)
-	var banEnd string
+	var banEnd sql.NullString
 	if duration > 0 {
-		banEnd = time.Now().Add(duration).UTC().Format(time.RFC3339)
+		banEnd = sql.NullString{String: time.Now().Add(duration).UTC().Format(time.RFC3339), Valid: true}
 	}
 
-	_, err := DB.Exec(`
-        INSERT INTO tempbans (user_id, guild_id, ban_start, ban_end, reason, banned_by)
-        VALUES (?,?,?,?,?,?)
-	`, userID, guildID, banStart, banEnd, reason, bannedBy)
-
+	id, err := st.insert(st.db, `
+        INSERT INTO tempbans (user_id, guild_id, ban_start, ban_end, reason, banned_by, status)
+        VALUES (?,?,?,?,?,?,?)`,
+		userID, guildID, banStart, banEnd, reason, bannedBy, BanStatusActive)
 	if err != nil {
 		log.Printf("Error adding ban: %v", err)
-	} else {
-		log.Printf("Add ban for user %s in guild %s until %v", userID, guildID, banEnd)
+		return 0, err
 	}
-	return err
+	log.Printf("Add ban %d for user %s in guild %s until %v", id, userID, guildID, banEnd.String)
+	return id, nil
 }
 
-func GetExpiredBans() ([]struct {
-	UserID  string
-	GuildID string
-}, error) {
+// GetExpiredBans returns active bans whose end time has passed
+func (st *SQLStore) GetExpiredBans() ([]Ban, error) {
 	now := time.Now().UTC().Format(time.RFC3339)
-	rows, err := DB.Query(`
-        SELECT user_id, guild_id
+	rows, err := st.query(`
+        SELECT `+banColumns+`
         FROM tempbans
-	    WHERE ban_end IS NOT NULL AND ban_end <= ?
-	`, now)
+	    WHERE status = ? AND ban_end IS NOT NULL AND ban_end != '' AND ban_end <= ?
+	`, BanStatusActive, now)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var expiredBans []struct {
-		UserID  string
-		GuildID string
-	}
-
+	var expiredBans []Ban
 	for rows.Next() {
-		var ban struct {
-			UserID  string
-			GuildID string
-		}
-		if err := rows.Scan(&ban.UserID, &ban.GuildID); err != nil {
+		ban, err := scanBan(rows)
+		if err != nil {
 			return nil, err
 		}
 		expiredBans = append(expiredBans, ban)
 	}
-	return expiredBans, nil
+	return expiredBans, rows.Err()
 }
 
-func RemoveTempBans(userID string) error {
-	_, err := DB.Exec("DELETE FROM tempbans WHERE user_id = ?", userID)
+// LiftBan marks a single active ban, addressed by its ID, as lifted with the given status
+func (st *SQLStore) LiftBan(banID int64, liftedBy, status string) error {
+	liftedAt := time.Now().UTC().Format(time.RFC3339)
+	_, err := st.exec(`
+        UPDATE tempbans
+        SET status = ?, lifted_at = ?, lifted_by = ?
+        WHERE id = ? AND status = ?
+	`, status, liftedAt, liftedBy, banID, BanStatusActive)
 	return err
 }
+
+// LiftGuildBans marks the user's active bans in one guild as lifted with the given status,
+// bans in other guilds are left untouched
+func (st *SQLStore) LiftGuildBans(userID, guildID, liftedBy, status string) error {
+	liftedAt := time.Now().UTC().Format(time.RFC3339)
+	_, err := st.exec(`
+        UPDATE tempbans
+        SET status = ?, lifted_at = ?, lifted_by = ?
+        WHERE user_id = ? AND guild_id = ? AND status = ?
+	`, status, liftedAt, liftedBy, userID, guildID, BanStatusActive)
+	return err
+}
+
+// GetBanHistory returns every ban recorded for the user in the guild, oldest first
+func (st *SQLStore) GetBanHistory(userID, guildID string) ([]Ban, error) {
+	rows, err := st.query(`
+        SELECT `+banColumns+`
+        FROM tempbans
+        WHERE user_id = ? AND guild_id = ?
+        ORDER BY ban_start, id
+	`, userID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []Ban
+	for rows.Next() {
+		ban, err := scanBan(rows)
+		if err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+
+// banColumns is the tempbans column list read by scanBan
+const banColumns = "id, user_id, guild_id, ban_start, ban_end, reason, banned_by, status, lifted_at, lifted_by"
+
+// scanBan reads one tempbans row selected with banColumns
+func scanBan(rows *sql.Rows) (Ban, error) {
+	var (
+		ban                                Ban
+		banStart                           string
+		banEnd, reason, liftedAt, liftedBy sql.NullString
+	)
+	err := rows.Scan(&ban.ID, &ban.UserID, &ban.GuildID, &banStart, &banEnd, &reason, &ban.BannedBy, &ban.Status, &liftedAt, &liftedBy)
+	if err != nil {
+		return ban, err
+	}
+	ban.BanStart = parseTime(banStart)
+	ban.BanEnd = parseTime(banEnd.String)
+	ban.Reason = reason.String
+	ban.LiftedAt = parseTime(liftedAt.String)
+	ban.LiftedBy = liftedBy.String
+	return ban, nil
+}
+
+// parseTime parses a stored RFC3339 time, empty or invalid values give the zero time
+func parseTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
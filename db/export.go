@@ -0,0 +1,210 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DumpVersion is the format version of the JSON written by Export
+const DumpVersion = 1
+
+// exportTables lists every bot table included in a dump, in restore order
+var exportTables = []string{"tempbans", "infractions"}
+
+// Dump is the JSON backup of all bot tables
+type Dump struct {
+	Version       int                         `json:"version"`
+	SchemaVersion int                         `json:"schema_version"`
+	ExportedAt    time.Time                   `json:"exported_at"`
+	Tables        map[string][]map[string]any `json:"tables"`
+}
+
+// Export writes every bot table to w as a versioned JSON dump
+func (st *SQLStore) Export(w io.Writer) error {
+	schemaVersion, err := st.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	dump := Dump{
+		Version:       DumpVersion,
+		SchemaVersion: schemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		Tables:        make(map[string][]map[string]any, len(exportTables)),
+	}
+	for _, table := range exportTables {
+		rows, err := st.exportTable(table)
+		if err != nil {
+			return fmt.Errorf("error exporting %s: %w", table, err)
+		}
+		dump.Tables[table] = rows
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dump)
+}
+
+// Import replaces the content of every bot table with the dump read from r,
+// all tables are restored in one transaction and upgraded to the current schema
+func (st *SQLStore) Import(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var dump Dump
+	if err := decoder.Decode(&dump); err != nil {
+		return fmt.Errorf("error reading dump: %w", err)
+	}
+	if dump.Version != DumpVersion {
+		return fmt.Errorf("unsupported dump version %d, expected %d", dump.Version, DumpVersion)
+	}
+
+	schemaVersion, err := st.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if dump.SchemaVersion > schemaVersion {
+		return fmt.Errorf("dump schema version %d is newer than database schema version %d", dump.SchemaVersion, schemaVersion)
+	}
+
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Rollback after a successful commit is a no-op
+		_ = tx.Rollback()
+	}()
+
+	for _, table := range exportTables {
+		if err := st.importTable(tx, table, dump.Tables[table]); err != nil {
+			return fmt.Errorf("error importing %s: %w", table, err)
+		}
+	}
+
+	// A dump of an older schema misses the data changes of the newer migrations, such as
+	// case numbers, so apply them to the imported rows. Every migration can run again.
+	for _, m := range migrations {
+		if m.version <= dump.SchemaVersion {
+			continue
+		}
+		if err := m.up(tx, st.dialect); err != nil {
+			return fmt.Errorf("error upgrading dump with migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// schemaVersion returns the latest applied migration
+func (st *SQLStore) schemaVersion() (int, error) {
+	var version int
+	err := st.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// exportTable reads every row of the table as column name to value
+func (st *SQLStore) exportTable(table string) ([]map[string]any, error) {
+	rows, err := st.db.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY id", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []map[string]any{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			// TEXT columns may come back as []byte, which JSON would base64 encode
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// importTable replaces the table content with rows, columns unknown to the
+// current schema are rejected and missing ones get their default value
+func (st *SQLStore) importTable(tx *sql.Tx, table string, rows []map[string]any) error {
+	columns, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", table)); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		names := make([]string, 0, len(row))
+		args := make([]any, 0, len(row))
+		for name, value := range row {
+			if !columns[name] {
+				return fmt.Errorf("unknown column %q", name)
+			}
+			if number, ok := value.(json.Number); ok {
+				value, err = number.Int64()
+				if err != nil {
+					return fmt.Errorf("column %q: %w", name, err)
+				}
+			}
+			names = append(names, name)
+			args = append(args, value)
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			table, strings.Join(names, ", "), strings.TrimSuffix(strings.Repeat("?,", len(names)), ","))
+		if _, err := tx.Exec(st.dialect.rebind(query), args...); err != nil {
+			return err
+		}
+	}
+
+	// Imported rows carry their own ids, move the PostgreSQL sequence past them
+	if st.dialect == Postgres {
+		_, err = tx.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s", table, table))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the set of column names of the table
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		columns[name] = true
+	}
+	return columns, nil
+}
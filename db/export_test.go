@@ -0,0 +1,66 @@
+package db
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestImportOlderSchemaNumbersCases(t *testing.T) {
+	store, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	defer store.Close()
+
+	// Dump of schema version 3, before infractions had case numbers
+	dump := `{
+		"version": 1,
+		"schema_version": 3,
+		"tables": {
+			"tempbans": [],
+			"infractions": [
+				{"id": 1, "type": "warn", "guild_id": "guild", "user_id": "user", "moderator_id": "mod", "reason": "spam", "source": "slash-command", "created_at": "2024-01-01T00:00:00Z"},
+				{"id": 2, "type": "warn", "guild_id": "other-guild", "user_id": "user", "moderator_id": "mod", "reason": "spam", "source": "slash-command", "created_at": "2024-01-02T00:00:00Z"},
+				{"id": 3, "type": "timeout", "guild_id": "guild", "user_id": "user", "moderator_id": "bot", "reason": "free nitro", "source": "automod-spam", "created_at": "2024-01-03T00:00:00Z"}
+			]
+		}
+	}`
+	if err := store.Import(strings.NewReader(dump)); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	modCase, err := store.GetCase("guild", 2)
+	if err != nil {
+		t.Fatalf("GetCase of imported case: %v", err)
+	}
+	if modCase.ID != 3 || modCase.Content != "free nitro" {
+		t.Errorf("case #2 = %+v, want infraction 3 with its message as content", modCase)
+	}
+
+	added, err := store.AddInfraction(Infraction{
+		Type:        InfractionWarn,
+		GuildID:     "guild",
+		UserID:      "user",
+		ModeratorID: "mod",
+		Source:      SourceSlashCommand,
+	})
+	if err != nil {
+		t.Fatalf("AddInfraction: %v", err)
+	}
+	if added.CaseNumber != 3 {
+		t.Errorf("new case after import is #%d, want #3", added.CaseNumber)
+	}
+
+	// The imported data exports and imports again unchanged
+	var exported bytes.Buffer
+	if err := store.Export(&exported); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if err := store.Import(&exported); err != nil {
+		t.Fatalf("Import of export: %v", err)
+	}
+	if _, err := store.GetCase("other-guild", 1); err != nil {
+		t.Errorf("GetCase after re-import: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Infraction types stored in the infractions table
+const (
+	InfractionWarn    = "warn"
+	InfractionTimeout = "timeout"
+	InfractionKick    = "kick"
+	InfractionBan     = "ban"
+	InfractionUnban   = "unban"
+	InfractionDelete  = "delete" // automod deleted a message without punishing the user
+	InfractionFlag    = "flag"   // automod only logged a message
+)
+
+// Infraction sources, the part of the bot that issued the infraction
+const (
+	SourceAutomodSpam     = "automod-spam"
+	SourceAutomodRapid    = "automod-rapid"
+	SourceAutomodFlood    = "automod-flood"
+	SourceAutomodPhishing = "automod-phishing"
+	SourceAutomodInvite   = "automod-invite"
+	SourceAutomodMention  = "automod-mention"
+	SourceSlashCommand    = "slash-command"
+)
+
+// ErrNotFound is returned when the requested record does not exist
+var ErrNotFound = errors.New("not found")
+
+// Infraction is a single moderation action taken against a user,
+// each one is a numbered case within its guild
+type Infraction struct {
+	ID           int64
+	CaseNumber   int64
+	Type         string
+	GuildID      string
+	UserID       string
+	ModeratorID  string
+	Reason       string
+	Content      string // offending message of automod cases, kept when the reason is edited
+	Source       string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time // zero for infractions that do not expire
+	LogChannelID string    // ban-log message of the case, empty until it is logged
+	LogMessageID string
+}
+
+// caseNumberRetries is how often AddInfraction retries when another
+// instance took the same case number at the same time
+const caseNumberRetries = 5
+
+// infractionColumns is the infractions column list read by scanInfraction
+const infractionColumns = "id, case_number, type, guild_id, user_id, moderator_id, reason, content, source, created_at, expires_at, log_channel_id, log_message_id"
+
+// AddInfraction records the infraction under the guild's next case number and
+// returns it with ID and CaseNumber set, a zero CreatedAt means now
+func (st *SQLStore) AddInfraction(inf Infraction) (Infraction, error) {
+	if inf.CreatedAt.IsZero() {
+		inf.CreatedAt = time.Now()
+	}
+	inf.CreatedAt = inf.CreatedAt.UTC().Truncate(time.Second)
+	var expiresAt sql.NullString
+	if !inf.ExpiresAt.IsZero() {
+		expiresAt = sql.NullString{String: inf.ExpiresAt.UTC().Format(time.RFC3339), Valid: true}
+	}
+
+	var err error
+	for attempt := 0; attempt < caseNumberRetries; attempt++ {
+		err = st.insertCase(&inf, expiresAt)
+		if err == nil {
+			return inf, nil
+		}
+	}
+	return inf, fmt.Errorf("error adding infraction: %w", err)
+}
+
+// insertCase inserts the infraction with the guild's next case number in one transaction,
+// the unique (guild_id, case_number) index rejects a number taken concurrently
+func (st *SQLStore) insertCase(inf *Infraction, expiresAt sql.NullString) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Rollback after a successful commit is a no-op
+		_ = tx.Rollback()
+	}()
+
+	var caseNumber int64
+	err = tx.QueryRow(st.dialect.rebind("SELECT COALESCE(MAX(case_number), 0) + 1 FROM infractions WHERE guild_id = ?"),
+		inf.GuildID).Scan(&caseNumber)
+	if err != nil {
+		return err
+	}
+
+	id, err := st.insert(tx, `
+        INSERT INTO infractions (case_number, type, guild_id, user_id, moderator_id, reason, content, source, created_at, expires_at)
+        VALUES (?,?,?,?,?,?,?,?,?,?)`,
+		caseNumber, inf.Type, inf.GuildID, inf.UserID, inf.ModeratorID, inf.Reason, inf.Content, inf.Source,
+		inf.CreatedAt.Format(time.RFC3339), expiresAt)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	inf.ID = id
+	inf.CaseNumber = caseNumber
+	return nil
+}
+
+// ListInfractions returns every infraction of the user in the guild, oldest first
+func (st *SQLStore) ListInfractions(userID, guildID string) ([]Infraction, error) {
+	rows, err := st.query(`
+        SELECT `+infractionColumns+`
+        FROM infractions
+        WHERE user_id = ? AND guild_id = ?
+        ORDER BY created_at, id
+	`, userID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var infractions []Infraction
+	for rows.Next() {
+		inf, err := scanInfraction(rows)
+		if err != nil {
+			return nil, err
+		}
+		infractions = append(infractions, inf)
+	}
+	return infractions, rows.Err()
+}
+
+// GetCase returns the infraction with the case number in the guild, or ErrNotFound
+func (st *SQLStore) GetCase(guildID string, caseNumber int64) (Infraction, error) {
+	rows, err := st.query(`
+        SELECT `+infractionColumns+`
+        FROM infractions
+        WHERE guild_id = ? AND case_number = ?
+	`, guildID, caseNumber)
+	if err != nil {
+		return Infraction{}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return Infraction{}, err
+		}
+		return Infraction{}, ErrNotFound
+	}
+	return scanInfraction(rows)
+}
+
+// UpdateCaseReason replaces the stored reason of the case and keeps its content, or returns ErrNotFound
+func (st *SQLStore) UpdateCaseReason(guildID string, caseNumber int64, reason string) error {
+	result, err := st.exec("UPDATE infractions SET reason = ? WHERE guild_id = ? AND case_number = ?",
+		reason, guildID, caseNumber)
+	return checkUpdated(result, err)
+}
+
+// SetCaseLogMessage stores the ban-log message posted for the case, or returns ErrNotFound
+func (st *SQLStore) SetCaseLogMessage(guildID string, caseNumber int64, channelID, messageID string) error {
+	result, err := st.exec("UPDATE infractions SET log_channel_id = ?, log_message_id = ? WHERE guild_id = ? AND case_number = ?",
+		channelID, messageID, guildID, caseNumber)
+	return checkUpdated(result, err)
+}
+
+// checkUpdated turns an UPDATE that matched no rows into ErrNotFound
+func checkUpdated(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// scanInfraction reads one infractions row selected with infractionColumns
+func scanInfraction(rows *sql.Rows) (Infraction, error) {
+	var (
+		inf                                                    Infraction
+		createdAt                                              string
+		caseNumber                                             sql.NullInt64
+		reason, content, expiresAt, logChannelID, logMessageID sql.NullString
+	)
+	err := rows.Scan(&inf.ID, &caseNumber, &inf.Type, &inf.GuildID, &inf.UserID, &inf.ModeratorID, &reason, &content, &inf.Source,
+		&createdAt, &expiresAt, &logChannelID, &logMessageID)
+	if err != nil {
+		return inf, err
+	}
+	inf.CaseNumber = caseNumber.Int64
+	inf.Reason = reason.String
+	inf.Content = content.String
+	inf.CreatedAt = parseTime(createdAt)
+	inf.ExpiresAt = parseTime(expiresAt.String)
+	inf.LogChannelID = logChannelID.String
+	inf.LogMessageID = logMessageID.String
+	return inf, nil
+}
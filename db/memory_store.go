@@ -0,0 +1,191 @@
+package db
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory Store for tests and local runs, nothing is persisted
+type MemoryStore struct {
+	mu               sync.Mutex
+	bans             []Ban
+	nextID           int64
+	infractions      []Infraction
+	nextInfractionID int64
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{nextID: 1, nextInfractionID: 1}
+}
+
+func (ms *MemoryStore) AddTempBan(userID, guildID, bannedBy string, duration time.Duration, reason string) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	ban := Ban{
+		ID:       ms.nextID,
+		UserID:   userID,
+		GuildID:  guildID,
+		BanStart: now,
+		Reason:   reason,
+		BannedBy: bannedBy,
+		Status:   BanStatusActive,
+	}
+	if duration > 0 {
+		ban.BanEnd = now.Add(duration)
+	}
+	ms.nextID++
+	ms.bans = append(ms.bans, ban)
+	return ban.ID, nil
+}
+
+func (ms *MemoryStore) GetExpiredBans() ([]Ban, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	var expiredBans []Ban
+	for _, ban := range ms.bans {
+		if ban.Status == BanStatusActive && !ban.BanEnd.IsZero() && !ban.BanEnd.After(now) {
+			expiredBans = append(expiredBans, ban)
+		}
+	}
+	return expiredBans, nil
+}
+
+func (ms *MemoryStore) LiftBan(banID int64, liftedBy, status string) error {
+	ms.liftWhere(liftedBy, status, func(ban Ban) bool {
+		return ban.ID == banID
+	})
+	return nil
+}
+
+func (ms *MemoryStore) LiftGuildBans(userID, guildID, liftedBy, status string) error {
+	ms.liftWhere(liftedBy, status, func(ban Ban) bool {
+		return ban.UserID == userID && ban.GuildID == guildID
+	})
+	return nil
+}
+
+func (ms *MemoryStore) GetBanHistory(userID, guildID string) ([]Ban, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var bans []Ban
+	for _, ban := range ms.bans {
+		if ban.UserID == userID && ban.GuildID == guildID {
+			bans = append(bans, ban)
+		}
+	}
+	sort.SliceStable(bans, func(a, b int) bool {
+		return bans[a].BanStart.Before(bans[b].BanStart)
+	})
+	return bans, nil
+}
+
+func (ms *MemoryStore) AddInfraction(inf Infraction) (Infraction, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if inf.CreatedAt.IsZero() {
+		inf.CreatedAt = time.Now()
+	}
+	inf.CreatedAt = inf.CreatedAt.UTC().Truncate(time.Second)
+	if !inf.ExpiresAt.IsZero() {
+		inf.ExpiresAt = inf.ExpiresAt.UTC().Truncate(time.Second)
+	}
+	inf.ID = ms.nextInfractionID
+	ms.nextInfractionID++
+	inf.CaseNumber = 1
+	for _, existing := range ms.infractions {
+		if existing.GuildID == inf.GuildID && existing.CaseNumber >= inf.CaseNumber {
+			inf.CaseNumber = existing.CaseNumber + 1
+		}
+	}
+	ms.infractions = append(ms.infractions, inf)
+	return inf, nil
+}
+
+func (ms *MemoryStore) ListInfractions(userID, guildID string) ([]Infraction, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var infractions []Infraction
+	for _, inf := range ms.infractions {
+		if inf.UserID == userID && inf.GuildID == guildID {
+			infractions = append(infractions, inf)
+		}
+	}
+	sort.SliceStable(infractions, func(a, b int) bool {
+		return infractions[a].CreatedAt.Before(infractions[b].CreatedAt)
+	})
+	return infractions, nil
+}
+
+func (ms *MemoryStore) GetCase(guildID string, caseNumber int64) (Infraction, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	inf := ms.findCase(guildID, caseNumber)
+	if inf == nil {
+		return Infraction{}, ErrNotFound
+	}
+	return *inf, nil
+}
+
+func (ms *MemoryStore) UpdateCaseReason(guildID string, caseNumber int64, reason string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	inf := ms.findCase(guildID, caseNumber)
+	if inf == nil {
+		return ErrNotFound
+	}
+	inf.Reason = reason
+	return nil
+}
+
+func (ms *MemoryStore) SetCaseLogMessage(guildID string, caseNumber int64, channelID, messageID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	inf := ms.findCase(guildID, caseNumber)
+	if inf == nil {
+		return ErrNotFound
+	}
+	inf.LogChannelID = channelID
+	inf.LogMessageID = messageID
+	return nil
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
+
+// liftWhere marks every active ban matching the filter as lifted
+func (ms *MemoryStore) liftWhere(liftedBy, status string, match func(Ban) bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := range ms.bans {
+		if ms.bans[i].Status == BanStatusActive && match(ms.bans[i]) {
+			ms.bans[i].Status = status
+			ms.bans[i].LiftedAt = now
+			ms.bans[i].LiftedBy = liftedBy
+		}
+	}
+}
+
+// findCase returns a pointer to the stored infraction, the caller must hold ms.mu
+func (ms *MemoryStore) findCase(guildID string, caseNumber int64) *Infraction {
+	for i := range ms.infractions {
+		if ms.infractions[i].GuildID == guildID && ms.infractions[i].CaseNumber == caseNumber {
+			return &ms.infractions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migration is a single versioned schema change, applied once and in order
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx, d Dialect) error
+}
+
+// migrations lists every schema change, append new ones with the next version number
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create tempbans",
+		up: func(tx *sql.Tx, d Dialect) error {
+			_, err := tx.Exec(`
+				CREATE TABLE IF NOT EXISTS tempbans (
+					id ` + d.primaryKey() + `,
+					user_id TEXT NOT NULL,
+					guild_id TEXT NOT NULL,
+					ban_start TEXT NOT NULL,
+					ban_end TEXT,
+					reason TEXT,
+					banned_by TEXT NOT NULL
+				)
+			`)
+			return err
+		},
+	},
+	{
+		version: 2,
+		name:    "ban history status",
+		up: func(tx *sql.Tx, d Dialect) error {
+			// Databases upgraded by the bot before migrations existed may already have these columns
+			for _, column := range []struct{ name, definition string }{
+				{"status", "TEXT NOT NULL DEFAULT 'active'"},
+				{"lifted_at", "TEXT"},
+				{"lifted_by", "TEXT"},
+			} {
+				if err := addColumnIfMissing(tx, d, "tempbans", column.name, column.definition); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 3,
+		name:    "create infractions",
+		up: func(tx *sql.Tx, d Dialect) error {
+			_, err := tx.Exec(`
+				CREATE TABLE IF NOT EXISTS infractions (
+					id ` + d.primaryKey() + `,
+					type TEXT NOT NULL,
+					guild_id TEXT NOT NULL,
+					user_id TEXT NOT NULL,
+					moderator_id TEXT NOT NULL,
+					reason TEXT,
+					source TEXT NOT NULL,
+					created_at TEXT NOT NULL,
+					expires_at TEXT
+				)
+			`)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("CREATE INDEX IF NOT EXISTS idx_infractions_guild_user ON infractions (guild_id, user_id)")
+			return err
+		},
+	},
+	{
+		version: 4,
+		name:    "infraction case numbers",
+		up: func(tx *sql.Tx, d Dialect) error {
+			for _, column := range []struct{ name, definition string }{
+				{"case_number", "INTEGER"},
+				{"log_channel_id", "TEXT"},
+				{"log_message_id", "TEXT"},
+			} {
+				if err := addColumnIfMissing(tx, d, "infractions", column.name, column.definition); err != nil {
+					return err
+				}
+			}
+
+			// Number existing infractions per guild in the order they were recorded
+			_, err := tx.Exec(`
+				UPDATE infractions SET case_number = (
+					SELECT COUNT(*) FROM infractions AS earlier
+					WHERE earlier.guild_id = infractions.guild_id AND earlier.id <= infractions.id
+				)
+			`)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_infractions_guild_case ON infractions (guild_id, case_number)")
+			return err
+		},
+	},
+	{
+		version: 5,
+		name:    "infraction message content",
+		up: func(tx *sql.Tx, d Dialect) error {
+			if err := addColumnIfMissing(tx, d, "infractions", "content", "TEXT"); err != nil {
+				return err
+			}
+
+			// Automod stored the offending message as the reason, keep it as the content
+			// so editing the reason does not lose it
+			_, err := tx.Exec("UPDATE infractions SET content = reason WHERE content IS NULL AND source LIKE 'automod-%'")
+			return err
+		},
+	},
+}
+
+// Migrate applies every pending migration to conn, each one in its own transaction.
+// Both dialects share the same migrations; for SQLite it also works on an in-memory
+// database opened with sql.Open("sqlite3", ":memory:") and SetMaxOpenConns(1).
+func Migrate(conn *sql.DB, d Dialect) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+
+	for _, m := range migrations {
+		applied, err := applyMigration(conn, d, m)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		if applied {
+			log.Printf("Applied database migration %d (%s)", m.version, m.name)
+		}
+	}
+	return nil
+}
+
+// migrationLockID is the PostgreSQL advisory lock key held while migrating,
+// so bot instances sharing one database do not run the same migration twice
+const migrationLockID = 7461926
+
+// applyMigration runs the migration and records its version in one transaction,
+// it returns false when the version was already applied
+func applyMigration(conn *sql.DB, d Dialect, m migration) (bool, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		// Rollback after a successful commit is a no-op
+		_ = tx.Rollback()
+	}()
+
+	if d == Postgres {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+			return false, err
+		}
+	}
+
+	var count int
+	err = tx.QueryRow(d.rebind("SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), m.version).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	if err := m.up(tx, d); err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(d.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?,?,?)"),
+		m.version, m.name, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// addColumnIfMissing adds the column to the table unless it already exists
+func addColumnIfMissing(tx *sql.Tx, d Dialect, table, column, definition string) error {
+	if d == Postgres {
+		_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, column, definition))
+		return err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// openMemoryDB opens a bare in-memory SQLite database without running migrations
+func openMemoryDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("opening in-memory database: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func appliedVersions(t *testing.T, conn *sql.DB) []int {
+	t.Helper()
+
+	rows, err := conn.Query("SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		t.Fatalf("reading schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			t.Fatalf("scanning version: %v", err)
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func columnNames(t *testing.T, conn *sql.DB, table string) map[string]bool {
+	t.Helper()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	columns, err := tableColumns(tx, table)
+	if err != nil {
+		t.Fatalf("reading columns of %s: %v", table, err)
+	}
+	return columns
+}
+
+func tableExists(t *testing.T, conn *sql.DB, table string) bool {
+	t.Helper()
+
+	var count int
+	err := conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count)
+	if err != nil {
+		t.Fatalf("checking table %s: %v", table, err)
+	}
+	return count > 0
+}
+
+func TestMigrateFreshSchema(t *testing.T) {
+	store, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	defer store.Close()
+
+	if got := appliedVersions(t, store.db); len(got) != len(migrations) {
+		t.Fatalf("applied versions = %v, want %d migrations", got, len(migrations))
+	}
+
+	for table, want := range map[string][]string{
+		"tempbans":    {"id", "user_id", "guild_id", "ban_start", "ban_end", "reason", "banned_by", "status", "lifted_at", "lifted_by"},
+		"infractions": {"id", "case_number", "type", "guild_id", "user_id", "moderator_id", "reason", "content", "source", "created_at", "expires_at", "log_channel_id", "log_message_id"},
+	} {
+		columns := columnNames(t, store.db, table)
+		for _, column := range want {
+			if !columns[column] {
+				t.Errorf("table %s is missing column %s", table, column)
+			}
+		}
+	}
+}
+
+func TestMigrateUpgradesBaselineTempbans(t *testing.T) {
+	conn := openMemoryDB(t)
+
+	// Schema created by the bot before migrations existed
+	_, err := conn.Exec(`
+		CREATE TABLE tempbans (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			guild_id TEXT NOT NULL,
+			ban_start TEXT NOT NULL,
+			ban_end TEXT,
+			reason TEXT,
+			banned_by TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		t.Fatalf("creating baseline table: %v", err)
+	}
+	_, err = conn.Exec(`INSERT INTO tempbans (user_id, guild_id, ban_start, ban_end, reason, banned_by)
+		VALUES ('user', 'guild', '2024-01-01T00:00:00Z', '2024-01-02T00:00:00Z', 'spam', 'bot')`)
+	if err != nil {
+		t.Fatalf("inserting baseline ban: %v", err)
+	}
+
+	if err := Migrate(conn, SQLite); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	var status string
+	if err := conn.QueryRow("SELECT status FROM tempbans WHERE user_id = 'user'").Scan(&status); err != nil {
+		t.Fatalf("reading upgraded ban: %v", err)
+	}
+	if status != BanStatusActive {
+		t.Errorf("status of existing ban = %q, want %q", status, BanStatusActive)
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	conn := openMemoryDB(t)
+
+	for run := 1; run <= 3; run++ {
+		if err := Migrate(conn, SQLite); err != nil {
+			t.Fatalf("Migrate run %d: %v", run, err)
+		}
+	}
+
+	if got := appliedVersions(t, conn); len(got) != len(migrations) {
+		t.Errorf("applied versions = %v, want each of %d migrations once", got, len(migrations))
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	conn := openMemoryDB(t)
+	if err := Migrate(conn, SQLite); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	original := migrations
+	t.Cleanup(func() { migrations = original })
+
+	failing := len(original) + 1
+	migrations = append(append([]migration{}, original...), migration{
+		version: failing,
+		name:    "failing",
+		up: func(tx *sql.Tx, d Dialect) error {
+			if _, err := tx.Exec("CREATE TABLE half_done (id INTEGER)"); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	})
+
+	if err := Migrate(conn, SQLite); err == nil {
+		t.Fatal("Migrate succeeded with a failing migration")
+	}
+
+	if tableExists(t, conn, "half_done") {
+		t.Error("table created by the failing migration was not rolled back")
+	}
+	var count int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = ?", failing).Scan(&count); err != nil {
+		t.Fatalf("reading schema_migrations: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("failing migration was recorded in schema_migrations")
+	}
+}
+
+func TestMigrateKeepsAutomodMessageAsContent(t *testing.T) {
+	conn := openMemoryDB(t)
+
+	// Database before infractions had a content column
+	original := migrations
+	t.Cleanup(func() { migrations = original })
+	migrations = original[:4]
+	if err := Migrate(conn, SQLite); err != nil {
+		t.Fatalf("Migrate to version 4: %v", err)
+	}
+	_, err := conn.Exec(`INSERT INTO infractions (case_number, type, guild_id, user_id, moderator_id, reason, source, created_at)
+		VALUES (1, 'timeout', 'guild', 'user', 'bot', 'free nitro', 'automod-spam', '2024-01-01T00:00:00Z'),
+		       (2, 'ban', 'guild', 'user', 'mod', 'raiding', 'slash-command', '2024-01-02T00:00:00Z')`)
+	if err != nil {
+		t.Fatalf("inserting infractions: %v", err)
+	}
+
+	migrations = original
+	if err := Migrate(conn, SQLite); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	for caseNumber, want := range map[int]string{1: "free nitro", 2: ""} {
+		var content sql.NullString
+		if err := conn.QueryRow("SELECT content FROM infractions WHERE case_number = ?", caseNumber).Scan(&content); err != nil {
+			t.Fatalf("reading case %d: %v", caseNumber, err)
+		}
+		if content.String != want {
+			t.Errorf("content of case %d = %q, want %q", caseNumber, content.String, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package db
+
+import "time"
+
+// Ban status values stored in the tempbans table
+const (
+	BanStatusActive       = "active"
+	BanStatusExpired      = "expired"
+	BanStatusLiftedManual = "lifted_manual"
+	BanStatusLiftedAppeal = "lifted_appeal"
+)
+
+// Ban is a single row of the ban history
+type Ban struct {
+	ID       int64
+	UserID   string
+	GuildID  string
+	BanStart time.Time
+	BanEnd   time.Time // zero for permanent bans
+	Reason   string
+	BannedBy string
+	Status   string
+	LiftedAt time.Time // zero while the ban is still active
+	LiftedBy string
+}
+
+// Store is the moderation storage used by automod, slashcommands and the unban ticker
+type Store interface {
+	// AddTempBan records a ban and returns its ID, duration 0 means a permanent ban
+	AddTempBan(userID, guildID, bannedBy string, duration time.Duration, reason string) (int64, error)
+	// GetExpiredBans returns active bans whose end time has passed
+	GetExpiredBans() ([]Ban, error)
+	// LiftBan marks a single active ban as lifted with the given status
+	LiftBan(banID int64, liftedBy, status string) error
+	// LiftGuildBans marks the user's active bans in one guild as lifted with the given status
+	LiftGuildBans(userID, guildID, liftedBy, status string) error
+	// GetBanHistory returns every ban recorded for the user in the guild, oldest first
+	GetBanHistory(userID, guildID string) ([]Ban, error)
+	// AddInfraction records the infraction under the guild's next case number and
+	// returns it with ID and CaseNumber set, a zero CreatedAt means now
+	AddInfraction(inf Infraction) (Infraction, error)
+	// ListInfractions returns every infraction of the user in the guild, oldest first
+	ListInfractions(userID, guildID string) ([]Infraction, error)
+	// GetCase returns the infraction with the case number in the guild, or ErrNotFound
+	GetCase(guildID string, caseNumber int64) (Infraction, error)
+	// UpdateCaseReason replaces the stored reason of the case and keeps its content, or returns ErrNotFound
+	UpdateCaseReason(guildID string, caseNumber int64, reason string) error
+	// SetCaseLogMessage stores the ban-log message posted for the case, or returns ErrNotFound
+	SetCaseLogMessage(guildID string, caseNumber int64, channelID, messageID string) error
+	// Close releases the storage
+	Close() error
+}
+
+var (
+	_ Store = (*SQLStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
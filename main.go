@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -26,6 +27,9 @@ var (
 	YoutubeNotificationChannelID string
 	BanLogChannelID              string
 	KingKongRoleID               string
+	DatabaseURL                  string
+	DatabasePath                 string
+	AutomodConfigFile            string
 
 	// Port Server for running the server
 	Port = "8080"
@@ -46,12 +50,41 @@ func main() {
 	YoutubeNotificationChannelID = os.Getenv("YOUTUBE_NOTIFICATION_CHANNEL_ID")
 	BanLogChannelID = os.Getenv("BAN_LOG_CHANNEL_ID")
 	KingKongRoleID = os.Getenv("ROLE_KINGKONG_ID")
+	DatabaseURL = os.Getenv("DATABASE_URL")
+	DatabasePath = os.Getenv("DATABASE_PATH")
+	AutomodConfigFile = os.Getenv("AUTOMOD_CONFIG_FILE")
+
+	// SQLite file is used when no database URL is configured
+	if DatabasePath == "" {
+		DatabasePath = "db/databot.sqlite"
+	}
+	if DatabaseURL == "" {
+		DatabaseURL = DatabasePath
+	}
+	if AutomodConfigFile == "" {
+		AutomodConfigFile = "automod.yaml"
+	}
 
 	// Initialize Database
-	err = db.InitDB()
+	store, err := db.Open(DatabaseURL)
 	if err != nil {
 		log.Fatalf("Error initilizing database: %v", err)
 	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}()
+
+	// Database backup subcommands run without connecting to Discord
+	if len(os.Args) > 1 {
+		if err := runDatabaseCommand(store, os.Args[1:]); err != nil {
+			log.Printf("Error running %s: %v", os.Args[1], err)
+			_ = store.Close()
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Discord bot Session
 	session, err := discordgo.New("Bot " + Token)
@@ -69,7 +102,7 @@ func main() {
 	fmt.Println("Bot working")
 
 	// Initialize antiscam init module
-	automod.Init(BanLogChannelID)
+	automod.Init(BanLogChannelID, store, AutomodConfigFile)
 
 	// Handler for Rapid Message
 	session.AddHandler(automod.CheckRapidMessages)
@@ -77,7 +110,7 @@ func main() {
 	session.AddHandler(automod.DeleteSpamMessage)
 
 	// Initialize slashcommands init module
-	slashcommands.InitBan(BanLogChannelID)
+	slashcommands.InitBan(BanLogChannelID, store)
 
 	// Handler for Slash Commands
 	session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
@@ -88,6 +121,16 @@ func main() {
 				slashcommands.UnbanhandlerCommand(s, i)
 			case "ban":
 				slashcommands.BanhandlerCommand(s, i)
+			case "case":
+				slashcommands.CasehandlerCommand(s, i)
+			case "modlogs":
+				slashcommands.ModlogshandlerCommand(s, i)
+			case "automod":
+				slashcommands.AutomodhandlerCommand(s, i)
+			}
+		case discordgo.InteractionMessageComponent:
+			if slashcommands.IsModlogsButton(i.MessageComponentData().CustomID) {
+				slashcommands.ModlogsButtonHandler(s, i)
 			}
 		}
 	})
@@ -102,8 +145,23 @@ func main() {
 		log.Printf("Error creating ban command: %v", err)
 	}
 
+	_, err = session.ApplicationCommandCreate(session.State.User.ID, "", slashcommands.CaseCommand)
+	if err != nil {
+		log.Printf("Error creating case command: %v", err)
+	}
+
+	_, err = session.ApplicationCommandCreate(session.State.User.ID, "", slashcommands.ModlogsCommand)
+	if err != nil {
+		log.Printf("Error creating modlogs command: %v", err)
+	}
+
+	_, err = session.ApplicationCommandCreate(session.State.User.ID, "", slashcommands.AutomodCommand)
+	if err != nil {
+		log.Printf("Error creating automod command: %v", err)
+	}
+
 	// Start database ban ticker
-	go banDatabaseTicker(session)
+	go banDatabaseTicker(session, store)
 
 	// Initialize Youtube Module
 	youtube.Init(YoutubeNotificationChannelID, VerifyToken, YoutubeAPIKey, KingKongRoleID)
@@ -138,6 +196,23 @@ func main() {
 		}
 	}()
 
+	// Reload automod config on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			loaded, err := automod.ReloadConfig()
+			if errors.Is(err, automod.ErrConfigNotLoaded) {
+				log.Printf("Automod reload failed, the previous rules are still in use: %v", err)
+				continue
+			}
+			if err != nil {
+				log.Printf("Automod config problems: %v", err)
+			}
+			log.Printf("Reloaded %d automod spam rules", loaded)
+		}
+	}()
+
 	// Kill discord bot
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
@@ -151,10 +226,10 @@ func main() {
 }
 
 // Function to check database ban status and unban if time is up
-func banDatabaseTicker(s *discordgo.Session) {
+func banDatabaseTicker(s *discordgo.Session, store db.Store) {
 	ticker := time.NewTicker(2 * time.Minute)
 	for range ticker.C {
-		expiredBans, err := db.GetExpiredBans()
+		expiredBans, err := store.GetExpiredBans()
 		if err != nil {
 			log.Printf("Error getting expired bans: %v", err)
 			continue
@@ -166,10 +241,51 @@ func banDatabaseTicker(s *discordgo.Session) {
 			} else {
 				log.Printf("Unbanned user %s from guild %s", ban.UserID, ban.GuildID)
 			}
-			err = db.RemoveTempBans(ban.UserID)
+			err = store.LiftBan(ban.ID, s.State.User.ID, db.BanStatusExpired)
 			if err != nil {
-				log.Printf("Error removing temporary ban for user %s: %v", ban.UserID, err)
+				log.Printf("Error marking ban %d as expired for user %s: %v", ban.ID, ban.UserID, err)
+			}
+		}
+	}
+}
+
+// runDatabaseCommand handles "export <file>" and "import <file>" for moving the bot
+// between hosts and restoring a broken database from a JSON backup
+func runDatabaseCommand(store *db.SQLStore, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s export|import <file>", os.Args[0])
+	}
+
+	switch args[0] {
+	case "export":
+		file, err := os.Create(args[1])
+		if err != nil {
+			return err
+		}
+		if err := store.Export(file); err != nil {
+			_ = file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		log.Printf("Exported database to %s", args[1])
+	case "import":
+		file, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				log.Printf("Error closing %s: %v", args[1], err)
 			}
+		}()
+		if err := store.Import(file); err != nil {
+			return err
 		}
+		log.Printf("Imported database from %s", args[1])
+	default:
+		return fmt.Errorf("unknown command %q, expected export or import", args[0])
 	}
+	return nil
 }
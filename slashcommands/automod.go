@@ -0,0 +1,92 @@
+package slashcommands
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+
+	"kings-bot/automod"
+)
+
+// adminPerms is the permission required for automod administration
+var adminPerms int64 = discordgo.PermissionAdministrator
+
+// AutomodCommand : Represents the Discord application command for automod administration
+var AutomodCommand = &discordgo.ApplicationCommand{
+	Name:        "automod",
+	Description: "Automod administration",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "reload",
+			Description: "Reload automod rules from the config file",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "block",
+			Description: "Add a domain to the phishing blocklist",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "domain",
+					Description: "Domain or link to block, subdomains are blocked too",
+					Required:    true,
+				},
+			},
+		},
+	},
+	DefaultMemberPermissions: &adminPerms, // Require administrator permission
+	DMPermission:             &defaultDM,  // Disable command in DM
+}
+
+// AutomodhandlerCommand : Handle the automod command when invoke by user
+func AutomodhandlerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Check permission or required role
+	if !hasRequiredRole(s, i.GuildID, i.Member) {
+		respondWithError(s, i, "You dont have permission to use this command")
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "reload":
+		loaded, err := automod.ReloadConfig()
+		if errors.Is(err, automod.ErrConfigNotLoaded) {
+			log.Printf("Automod reload failed: %v", err)
+			respondEphemeral(s, i, fmt.Sprintf("Reload failed, the previous automod rules are still in use.\n```%v```", err))
+			return
+		}
+		message := fmt.Sprintf("Reloaded %d automod spam rules.", loaded)
+		if err != nil {
+			log.Printf("Automod config problems: %v", err)
+			message += fmt.Sprintf("\nProblems:\n```%v```", err)
+		}
+		respondEphemeral(s, i, message)
+
+	case "block":
+		domain, err := automod.BlockDomain(subcommand.Options[0].StringValue())
+		if err != nil {
+			log.Printf("Error blocking phishing domain: %v", err)
+			respondWithError(s, i, fmt.Sprintf("Could not block domain: %v", err))
+			return
+		}
+		log.Printf("%s added %s to the phishing blocklist", i.Member.User.Username, domain)
+		respondEphemeral(s, i, fmt.Sprintf("Added `%s` to the phishing blocklist.", domain))
+	}
+}
+
+// respondEphemeral Function to answer an automod command only visible to the admin using it
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, message string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: message,
+			Flags:   discordgo.MessageFlagsEphemeral, // Hide message from other user
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to respond to automod command: %v", err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 // variable used across the package
 var (
 	banLogChannelID string
+	store           db.Store
 	defaultPerms    int64 = discordgo.PermissionBanMembers // Minimum permission required
 	defaultDM             = false                          // disable command in DM
 )
@@ -34,6 +35,12 @@ var UnbanCommand = &discordgo.ApplicationCommand{
 			Description: "Insert Reason",
 			Required:    true,
 		},
+		{
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+			Name:        "appeal",
+			Description: "Ban lifted after an appeal",
+			Required:    false,
+		},
 	},
 	DefaultMemberPermissions: &defaultPerms, // User must have permission to ban member
 	DMPermission:             &defaultDM,    // Disable command in DM
@@ -55,6 +62,12 @@ func UnbanhandlerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		reason = options[1].StringValue()
 	}
 
+	// Ban lifted by appeal or manually by MOD
+	liftStatus := db.BanStatusLiftedManual
+	if len(options) > 2 && options[2].BoolValue() {
+		liftStatus = db.BanStatusLiftedAppeal
+	}
+
 	// Check if the user is still banned
 	bans, err := s.GuildBans(i.GuildID, 1000, "", "")
 	if err != nil {
@@ -81,6 +94,25 @@ func UnbanhandlerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 
+	// Keep the ban in history as lifted
+	err = store.LiftGuildBans(userID, i.GuildID, i.Member.User.ID, liftStatus)
+	if err != nil {
+		log.Printf("Error marking ban as lifted for user %s: %v", userID, err)
+	}
+
+	// Record unban in moderation history
+	unbanCase, err := store.AddInfraction(db.Infraction{
+		Type:        db.InfractionUnban,
+		GuildID:     i.GuildID,
+		UserID:      userID,
+		ModeratorID: i.Member.User.ID,
+		Reason:      reason,
+		Source:      db.SourceSlashCommand,
+	})
+	if err != nil {
+		log.Printf("Error adding unban infraction to database: %v", err)
+	}
+
 	// Embed message for confirmation unban
 	embed := &discordgo.MessageEmbed{
 		Title: "User Unbanned",
@@ -108,6 +140,12 @@ func UnbanhandlerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		},
 	}
 
+	// Send unban log to specific channel
+	err = sendCaseLog(s, i.GuildID, embed, unbanCase)
+	if err != nil {
+		log.Printf("Failed to send unban log message: %v", err)
+	}
+
 	// Send respond confirmation for successful unban command
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -186,9 +224,10 @@ var BanCommand = &discordgo.ApplicationCommand{
 	DMPermission:             &defaultDM,    // Disable command in DM
 }
 
-// InitBan Init the ban log channel
-func InitBan(logChannelID string) {
+// InitBan Init the ban log channel and the ban storage
+func InitBan(logChannelID string, banStore db.Store) {
 	banLogChannelID = logChannelID
+	store = banStore
 }
 
 // Fetch banned user information (username)
@@ -251,12 +290,36 @@ func BanhandlerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 
-	// Add temporary ban to database to track timed bans
+	// Add ban to database, timed bans are lifted by the ticker and permanent bans are kept as history
+	_, err = store.AddTempBan(userID, i.GuildID, i.Member.User.ID, banDuration, reason)
+	if err != nil {
+		log.Printf("Error adding ban to database: %v", err)
+	}
+
+	// Record ban in moderation history
+	infraction := db.Infraction{
+		Type:        db.InfractionBan,
+		GuildID:     i.GuildID,
+		UserID:      userID,
+		ModeratorID: i.Member.User.ID,
+		Reason:      reason,
+		Source:      db.SourceSlashCommand,
+	}
 	if banDurationHours > 0 {
-		err = db.AddTempBan(userID, i.GuildID, i.Member.User.ID, banDuration, reason)
-		if err != nil {
-			log.Printf("Error adding temporary ban to database: %v", err)
-		}
+		infraction.ExpiresAt = banEndTime
+	}
+	banCase, err := store.AddInfraction(infraction)
+	if err != nil {
+		log.Printf("Error adding ban infraction to database: %v", err)
+	}
+
+	// Count all bans for this user, including the current one
+	banCount := 0
+	banHistory, err := store.GetBanHistory(userID, i.GuildID)
+	if err != nil {
+		log.Printf("Error getting ban history for user %s: %v", userID, err)
+	} else {
+		banCount = len(banHistory)
 	}
 
 	// Create ember for log message
@@ -292,12 +355,17 @@ func BanhandlerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				Value:  fmt.Sprintf("%s, <t:%d:R>", durationString, banEndTime.Unix()),
 				Inline: true,
 			},
+			{
+				Name:   "Total Bans",
+				Value:  fmt.Sprintf("%d", banCount),
+				Inline: true,
+			},
 		},
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
 
 	// Send ban log to specific channel
-	_, err = s.ChannelMessageSendEmbed(banLogChannelID, logEmbed)
+	err = sendCaseLog(s, i.GuildID, logEmbed, banCase)
 	if err != nil {
 		respondWithError(s, i, fmt.Sprintf("Failed to send log message: %v", err))
 		return
@@ -0,0 +1,253 @@
+package slashcommands
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"kings-bot/db"
+)
+
+// caseFieldLimit keeps the reason and message of a case under Discord's 1024 character
+// embed field limit, leaving room for the code block fences
+const caseFieldLimit = 1000
+
+// CaseCommand : Represents the Discord application command to view and edit moderation cases
+var CaseCommand = &discordgo.ApplicationCommand{
+	Name:        "case",
+	Description: "View or edit a moderation case",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "view",
+			Description: "Show a moderation case",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "id",
+					Description: "Case number",
+					Required:    true,
+					MinValue:    &[]float64{1}[0],
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "reason",
+			Description: "Update the reason of a moderation case",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "id",
+					Description: "Case number",
+					Required:    true,
+					MinValue:    &[]float64{1}[0],
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "text",
+					Description: "New reason",
+					Required:    true,
+				},
+			},
+		},
+	},
+	DefaultMemberPermissions: &defaultPerms, // Require ban permission role
+	DMPermission:             &defaultDM,    // Disable command in DM
+}
+
+// CasehandlerCommand : Handle the case command when invoke by user
+func CasehandlerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Check permission or required role
+	if !hasRequiredRole(s, i.GuildID, i.Member) {
+		respondWithError(s, i, "You dont have permission to use this command")
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	caseNumber := subcommand.Options[0].IntValue()
+
+	modCase, err := store.GetCase(i.GuildID, caseNumber)
+	if errors.Is(err, db.ErrNotFound) {
+		respondWithError(s, i, fmt.Sprintf("Case #%d does not exist.", caseNumber))
+		return
+	}
+	if err != nil {
+		respondWithError(s, i, fmt.Sprintf("Failed to retrieve case: %v", err))
+		return
+	}
+
+	switch subcommand.Name {
+	case "view":
+		respondWithCase(s, i, modCase)
+	case "reason":
+		reason := subcommand.Options[1].StringValue()
+
+		err = store.UpdateCaseReason(i.GuildID, caseNumber, reason)
+		if err != nil {
+			respondWithError(s, i, fmt.Sprintf("Failed to update case: %v", err))
+			return
+		}
+		modCase.Reason = reason
+
+		// Edit reason in the original log message
+		editCaseLogReason(s, modCase)
+
+		respondWithCase(s, i, modCase)
+	}
+}
+
+// Build embed showing the stored case
+func caseEmbed(modCase db.Infraction) *discordgo.MessageEmbed {
+	expires := "Never"
+	if !modCase.ExpiresAt.IsZero() {
+		expires = fmt.Sprintf("<t:%d:F>", modCase.ExpiresAt.Unix())
+	}
+
+	reason := modCase.Reason
+	if reason == "" {
+		reason = "No reason provided"
+	}
+	reason = truncateCaseField(reason)
+
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Case #%d | %s", modCase.CaseNumber, strings.ToUpper(modCase.Type)),
+		Color: 0xffa500,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "User",
+				Value:  fmt.Sprintf("<@%s> (%s)", modCase.UserID, modCase.UserID),
+				Inline: true,
+			},
+			{
+				Name:   "Moderator",
+				Value:  fmt.Sprintf("<@%s>", modCase.ModeratorID),
+				Inline: true,
+			},
+			{
+				Name:   "Source",
+				Value:  modCase.Source,
+				Inline: true,
+			},
+			{
+				Name:   "Created",
+				Value:  fmt.Sprintf("<t:%d:F>", modCase.CreatedAt.Unix()),
+				Inline: true,
+			},
+			{
+				Name:   "Expires",
+				Value:  expires,
+				Inline: true,
+			},
+			{
+				Name:   "Reason",
+				Value:  reason,
+				Inline: false,
+			},
+		},
+		Timestamp: modCase.CreatedAt.Format(time.RFC3339),
+	}
+
+	if modCase.Content != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Message",
+			Value:  fmt.Sprintf("```%s```", truncateCaseField(modCase.Content)),
+			Inline: false,
+		})
+	}
+
+	if modCase.LogChannelID != "" && modCase.LogMessageID != "" {
+		embed.URL = fmt.Sprintf("https://discord.com/channels/%s/%s/%s", modCase.GuildID, modCase.LogChannelID, modCase.LogMessageID)
+	}
+	return embed
+}
+
+// Send case embed as response, mentions are not pinged
+func respondWithCase(s *discordgo.Session, i *discordgo.InteractionCreate, modCase db.Infraction) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{caseEmbed(modCase)},
+			AllowedMentions: &discordgo.MessageAllowedMentions{
+				Parse: []discordgo.AllowedMentionType{},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to respond with case %d: %v", modCase.CaseNumber, err)
+	}
+}
+
+// Send log embed with case number to ban-log channel and remember the message for /case reason
+func sendCaseLog(s *discordgo.Session, guildID string, logEmbed *discordgo.MessageEmbed, modCase db.Infraction) error {
+	if modCase.CaseNumber > 0 {
+		logEmbed.Title = fmt.Sprintf("%s | Case #%d", logEmbed.Title, modCase.CaseNumber)
+	}
+
+	logMessage, err := s.ChannelMessageSendEmbed(banLogChannelID, logEmbed)
+	if err != nil {
+		return err
+	}
+
+	if modCase.CaseNumber > 0 {
+		err = store.SetCaseLogMessage(guildID, modCase.CaseNumber, logMessage.ChannelID, logMessage.ID)
+		if err != nil {
+			log.Printf("Error saving log message for case %d: %v", modCase.CaseNumber, err)
+		}
+	}
+	return nil
+}
+
+// Replace the reason field of the case log message, the offending message field stays
+func editCaseLogReason(s *discordgo.Session, modCase db.Infraction) {
+	if modCase.LogChannelID == "" || modCase.LogMessageID == "" {
+		return
+	}
+
+	logMessage, err := s.ChannelMessage(modCase.LogChannelID, modCase.LogMessageID)
+	if err != nil {
+		log.Printf("Failed to fetch log message for case %d: %v", modCase.CaseNumber, err)
+		return
+	}
+	if len(logMessage.Embeds) == 0 {
+		return
+	}
+
+	logEmbed := logMessage.Embeds[0]
+	hasMessage := slices.ContainsFunc(logEmbed.Fields, func(field *discordgo.MessageEmbedField) bool {
+		return field.Name == "Message"
+	})
+	for index, field := range logEmbed.Fields {
+		if field.Name != "Reason" {
+			continue
+		}
+		// Older automod log messages show the offending message as the reason in a code block,
+		// move it to its own field before replacing the reason
+		if !hasMessage && strings.HasPrefix(field.Value, "```") {
+			logEmbed.Fields = slices.Insert(logEmbed.Fields, index+1, &discordgo.MessageEmbedField{
+				Name:  "Message",
+				Value: field.Value,
+			})
+		}
+		field.Value = truncateCaseField(modCase.Reason)
+		break
+	}
+
+	_, err = s.ChannelMessageEditEmbed(modCase.LogChannelID, modCase.LogMessageID, logEmbed)
+	if err != nil {
+		log.Printf("Failed to edit log message for case %d: %v", modCase.CaseNumber, err)
+	}
+}
+
+// Shorten text to fit an embed field
+func truncateCaseField(text string) string {
+	if runes := []rune(text); len(runes) > caseFieldLimit {
+		return string(runes[:caseFieldLimit]) + "..."
+	}
+	return text
+}
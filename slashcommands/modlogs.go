@@ -0,0 +1,268 @@
+package slashcommands
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"kings-bot/db"
+)
+
+const (
+	// modlogsPageSize is the number of history entries shown on one page
+	modlogsPageSize = 5
+	// modlogsButtonPrefix prefixes the custom ID of the page buttons: modlogs:<userID>:<page>
+	modlogsButtonPrefix = "modlogs:"
+	// modlogsReasonLimit keeps long reasons from overflowing the embed field
+	modlogsReasonLimit = 300
+)
+
+// ModlogsCommand : Represents the Discord application command listing a user's moderation history
+var ModlogsCommand = &discordgo.ApplicationCommand{
+	Name:        "modlogs",
+	Description: "Show moderation history of a user",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionUser,
+			Name:        "user",
+			Description: "User to look up",
+			Required:    true,
+		},
+	},
+	DefaultMemberPermissions: &defaultPerms, // Require ban permission role
+	DMPermission:             &defaultDM,    // Disable command in DM
+}
+
+// modlogEntry is one line of the moderation history, built from an infraction or a ban record
+type modlogEntry struct {
+	time        time.Time
+	title       string
+	moderatorID string
+	reason      string
+	expiresAt   time.Time
+}
+
+// ModlogshandlerCommand : Handle the modlogs command when invoke by user
+func ModlogshandlerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Check permission or required role
+	if !hasRequiredRole(s, i.GuildID, i.Member) {
+		respondWithError(s, i, "You dont have permission to use this command")
+		return
+	}
+
+	user := i.ApplicationCommandData().Options[0].UserValue(s)
+	if user == nil {
+		respondWithError(s, i, "Failed to retrieve user")
+		return
+	}
+
+	respondWithModlogs(s, i, discordgo.InteractionResponseChannelMessageWithSource, user.ID, 0)
+}
+
+// ModlogsButtonHandler : Handle the previous and next buttons of a modlogs message
+func ModlogsButtonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Check permission or required role
+	if !hasRequiredRole(s, i.GuildID, i.Member) {
+		respondWithError(s, i, "You dont have permission to use this command")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(i.MessageComponentData().CustomID, modlogsButtonPrefix), ":")
+	if len(parts) != 2 {
+		return
+	}
+	page, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return
+	}
+
+	respondWithModlogs(s, i, discordgo.InteractionResponseUpdateMessage, parts[0], page)
+}
+
+// IsModlogsButton reports whether the component custom ID belongs to a modlogs message
+func IsModlogsButton(customID string) bool {
+	return strings.HasPrefix(customID, modlogsButtonPrefix)
+}
+
+// Build the requested history page and send it as new message or as update of the current one
+func respondWithModlogs(s *discordgo.Session, i *discordgo.InteractionCreate, responseType discordgo.InteractionResponseType, userID string, page int) {
+	entries, err := loadModlogEntries(userID, i.GuildID)
+	if err != nil {
+		respondWithError(s, i, fmt.Sprintf("Failed to retrieve moderation history: %v", err))
+		return
+	}
+
+	pageCount := (len(entries) + modlogsPageSize - 1) / modlogsPageSize
+	if pageCount == 0 {
+		pageCount = 1
+	}
+	page = max(0, min(page, pageCount-1))
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Moderation History",
+		Description: fmt.Sprintf("<@%s> (%s) has %d recorded actions", userID, userID, len(entries)),
+		Color:       0xffa500,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Page %d/%d", page+1, pageCount),
+		},
+	}
+
+	start := page * modlogsPageSize
+	end := min(start+modlogsPageSize, len(entries))
+	for _, entry := range entries[start:end] {
+		embed.Fields = append(embed.Fields, entry.field())
+	}
+
+	// Only show buttons when there is more than one page
+	var components []discordgo.MessageComponent
+	if pageCount > 1 {
+		components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Previous",
+						Style:    discordgo.SecondaryButton,
+						CustomID: fmt.Sprintf("%s%s:%d", modlogsButtonPrefix, userID, page-1),
+						Disabled: page == 0,
+					},
+					discordgo.Button{
+						Label:    "Next",
+						Style:    discordgo.SecondaryButton,
+						CustomID: fmt.Sprintf("%s%s:%d", modlogsButtonPrefix, userID, page+1),
+						Disabled: page >= pageCount-1,
+					},
+				},
+			},
+		}
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: responseType,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+			AllowedMentions: &discordgo.MessageAllowedMentions{
+				Parse: []discordgo.AllowedMentionType{},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to respond with modlogs for user %s: %v", userID, err)
+	}
+}
+
+// Collect infractions and automatic ban expiries of the user, newest first.
+// Bans and manual unbans without a matching infraction, like those recorded before the
+// infractions table existed, are listed from the ban history.
+func loadModlogEntries(userID, guildID string) ([]modlogEntry, error) {
+	infractions, err := store.ListInfractions(userID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	bans, err := store.GetBanHistory(userID, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]modlogEntry, 0, len(infractions)+len(bans))
+	for _, inf := range infractions {
+		entries = append(entries, modlogEntry{
+			time:        inf.CreatedAt,
+			title:       fmt.Sprintf("Case #%d | %s (%s)", inf.CaseNumber, strings.ToUpper(inf.Type), inf.Source),
+			moderatorID: inf.ModeratorID,
+			reason:      inf.Reason,
+			expiresAt:   inf.ExpiresAt,
+		})
+	}
+
+	matched := make(map[int64]bool)
+	for _, ban := range bans {
+		if !matchInfraction(infractions, matched, db.InfractionBan, ban.BanStart) {
+			entries = append(entries, modlogEntry{
+				time:        ban.BanStart,
+				title:       "BAN (no case)",
+				moderatorID: ban.BannedBy,
+				reason:      ban.Reason,
+				expiresAt:   ban.BanEnd,
+			})
+		}
+
+		switch ban.Status {
+		case db.BanStatusExpired:
+			entries = append(entries, modlogEntry{
+				time:        ban.LiftedAt,
+				title:       "UNBAN (ban expired)",
+				moderatorID: ban.LiftedBy,
+				reason:      ban.Reason,
+			})
+		case db.BanStatusLiftedManual, db.BanStatusLiftedAppeal:
+			if !matchInfraction(infractions, matched, db.InfractionUnban, ban.LiftedAt) {
+				title := "UNBAN (manual, no case)"
+				if ban.Status == db.BanStatusLiftedAppeal {
+					title = "UNBAN (appeal, no case)"
+				}
+				entries = append(entries, modlogEntry{
+					time:        ban.LiftedAt,
+					title:       title,
+					moderatorID: ban.LiftedBy,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].time.After(entries[b].time)
+	})
+	return entries, nil
+}
+
+// banCaseTolerance is how far apart a ban record and its infraction may be created
+const banCaseTolerance = time.Minute
+
+// Find the unmatched infraction of the type created closest to at and mark it as matched,
+// one /unban lifts all bans of a guild, so unban infractions may match several bans
+func matchInfraction(infractions []db.Infraction, matched map[int64]bool, infractionType string, at time.Time) bool {
+	best := -1
+	var bestDiff time.Duration
+	for i, inf := range infractions {
+		if inf.Type != infractionType || (matched[inf.ID] && infractionType != db.InfractionUnban) {
+			continue
+		}
+		diff := inf.CreatedAt.Sub(at).Abs()
+		if diff <= banCaseTolerance && (best < 0 || diff < bestDiff) {
+			best, bestDiff = i, diff
+		}
+	}
+	if best < 0 {
+		return false
+	}
+	matched[infractions[best].ID] = true
+	return true
+}
+
+// Format entry as embed field
+func (entry modlogEntry) field() *discordgo.MessageEmbedField {
+	reason := entry.reason
+	if reason == "" {
+		reason = "No reason provided"
+	}
+	if runes := []rune(reason); len(runes) > modlogsReasonLimit {
+		reason = string(runes[:modlogsReasonLimit]) + "..."
+	}
+
+	value := fmt.Sprintf("<t:%d:f> by <@%s>", entry.time.Unix(), entry.moderatorID)
+	if !entry.expiresAt.IsZero() {
+		value += fmt.Sprintf(", expires <t:%d:R>", entry.expiresAt.Unix())
+	}
+	value += "\n" + reason
+
+	return &discordgo.MessageEmbedField{
+		Name:  entry.title,
+		Value: value,
+	}
+}